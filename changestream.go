@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	CHANGE_STREAM_DEBOUNCE_S   = 20 // Wait product stop changing before sync it.
+	CHANGE_STREAM_RETRY_S      = 30
+	CHANGE_STREAM_SAVE_TOKEN_S = 10 // Min interval to save resume token.
+	// Change stream resume token db param name.
+	CHANGE_STREAM_RESUME_TOKEN = "ZOOMPRODUCTS-change-stream-resume-token"
+)
+
+// Sync modes.
+const (
+	SYNC_MODE_POLLING       = "polling"
+	SYNC_MODE_CHANGE_STREAM = "changestream"
+)
+
+// Sync mode.
+var syncMode string
+
+// Product changed and not synced yet.
+type changedProduct struct {
+	ChangedAt time.Time
+	Seq       int64    // First event not synced.
+	Token     bson.Raw // Resume token before first event not synced.
+}
+
+// Products synced, waiting tickets to finish.
+type changedProductsSync struct {
+	TicketsID []string
+	Products  map[string]*changedProduct
+}
+
+// Products changed and not synced yet, by product id.
+var changedProducts = map[string]*changedProduct{}
+
+// Products synced waiting tickets.
+var changedProductsSyncs = []*changedProductsSync{}
+
+// Resume token from last received change event, and events received.
+var changeStreamResumeToken bson.Raw
+var changeStreamSeq int64
+
+// Last resume token saved.
+var changeStreamSavedToken bson.Raw
+
+var muxChangedProducts sync.Mutex
+
+// Change stream goroutines, waited when stop leading.
+var changeStreamWorkers sync.WaitGroup
+
+// Product change event.
+type productChangeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// Init sync mode.
+func initSyncMode() {
+	// ZOOM_SYNC_MODE=polling|changestream
+	syncMode = os.Getenv("ZOOM_SYNC_MODE")
+	if syncMode == "" {
+		syncMode = SYNC_MODE_POLLING
+	}
+	if syncMode != SYNC_MODE_POLLING && syncMode != SYNC_MODE_CHANGE_STREAM {
+		panic("ZOOM_SYNC_MODE must be polling or changestream.")
+	}
+}
+
+// Start watching products changes, false if change stream is not supported.
+func startChangeStream(ctx context.Context) bool {
+	collection := client.Database("zunka").Collection("products")
+	token := getChangeStreamResumeToken()
+	changeStream, err := collection.Watch(ctx, mongo.Pipeline{}, changeStreamOptions(token))
+	if err != nil {
+		// Standalone mongo not support change stream.
+		log.Printf("[warn] Could not watch products changes, using polling. %v", err)
+		syncMode = SYNC_MODE_POLLING
+		return false
+	}
+	log.Println("Watching products changes")
+	muxChangedProducts.Lock()
+	changedProducts = map[string]*changedProduct{}
+	changedProductsSyncs = []*changedProductsSync{}
+	changeStreamResumeToken = token
+	changeStreamSavedToken = token
+	muxChangedProducts.Unlock()
+	changeStreamWorkers.Add(2)
+	go watchProducts(ctx, changeStream)
+	go syncChangedProducts(ctx)
+	return true
+}
+
+// Wait change stream goroutines stop, after its context is canceled.
+func waitChangeStream(timeout time.Duration) bool {
+	stopped := make(chan bool)
+	go func() {
+		changeStreamWorkers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Change stream options, resume after token.
+func changeStreamOptions(token bson.Raw) *options.ChangeStreamOptions {
+	changeStreamOptions := options.ChangeStream()
+	if token != nil {
+		changeStreamOptions.SetResumeAfter(token)
+	}
+	return changeStreamOptions
+}
+
+// Watch products changes, reopen change stream on error.
+func watchProducts(ctx context.Context, changeStream *mongo.ChangeStream) {
+	defer changeStreamWorkers.Done()
+	collection := client.Database("zunka").Collection("products")
+	for {
+		for changeStream.Next(ctx) {
+			event := productChangeEvent{}
+			err := changeStream.Decode(&event)
+			if checkError(err) {
+				continue
+			}
+			muxChangedProducts.Lock()
+			productChanged(event.DocumentKey.ID.Hex(), productChangeAffectZoom(&event), changeStream.ResumeToken(), time.Now())
+			muxChangedProducts.Unlock()
+		}
+		changeStream.Close(context.Background())
+		if ctx.Err() != nil {
+			log.Println("Change stream stopped")
+			return
+		}
+		checkError(changeStream.Err())
+
+		// Reopen.
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(CHANGE_STREAM_RETRY_S * time.Second):
+			}
+			// Resume after last received event.
+			muxChangedProducts.Lock()
+			token := changeStreamResumeToken
+			muxChangedProducts.Unlock()
+			var err error
+			changeStream, err = collection.Watch(ctx, mongo.Pipeline{}, changeStreamOptions(token))
+			if !checkError(err) {
+				log.Println("Change stream reopened")
+				break
+			}
+		}
+	}
+}
+
+// Check if product change affect product at Zoom.
+func productChangeAffectZoom(event *productChangeEvent) bool {
+	if event.OperationType != "update" {
+		return true
+	}
+	fields := []string{}
+	for field := range event.UpdateDescription.UpdatedFields {
+		fields = append(fields, field)
+	}
+	fields = append(fields, event.UpdateDescription.RemovedFields...)
+	for _, field := range fields {
+		// Nested field, like images.0.
+		field = strings.Split(field, ".")[0]
+		for _, projectionField := range zunkaProductProjection {
+			if field == projectionField.Key && field != "updatedAt" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Change event received, must be called with muxChangedProducts locked.
+func productChanged(productID string, affectZoom bool, token bson.Raw, now time.Time) {
+	changeStreamSeq++
+	if affectZoom {
+		product, ok := changedProducts[productID]
+		if !ok {
+			product = &changedProduct{Seq: changeStreamSeq, Token: changeStreamResumeToken}
+			changedProducts[productID] = product
+		}
+		product.ChangedAt = now
+	}
+	changeStreamResumeToken = token
+}
+
+// Products synced again, keeping its first event not synced, must be called with muxChangedProducts locked.
+func requeueChangedProducts(products map[string]*changedProduct, now time.Time) {
+	for id, product := range products {
+		queued, ok := changedProducts[id]
+		if !ok {
+			changedProducts[id] = &changedProduct{ChangedAt: now, Seq: product.Seq, Token: product.Token}
+			continue
+		}
+		if product.Seq < queued.Seq {
+			queued.Seq, queued.Token = product.Seq, product.Token
+		}
+	}
+}
+
+// Resume token before oldest event not synced, must be called with muxChangedProducts locked.
+func changeStreamSyncedToken() bson.Raw {
+	token := changeStreamResumeToken
+	var seq int64 = -1
+	oldest := func(product *changedProduct) {
+		if seq == -1 || product.Seq < seq {
+			seq, token = product.Seq, product.Token
+		}
+	}
+	for _, product := range changedProducts {
+		oldest(product)
+	}
+	for _, pending := range changedProductsSyncs {
+		for _, product := range pending.Products {
+			oldest(product)
+		}
+	}
+	return token
+}
+
+// Change stream ticket finished, products are synced again if ticket failed, must be called with muxUpdateZoomProducts locked.
+func changeStreamTicketFinished(ticketID string, ok bool) {
+	muxChangedProducts.Lock()
+	defer muxChangedProducts.Unlock()
+	syncs := []*changedProductsSync{}
+	for _, pending := range changedProductsSyncs {
+		ticketsID := []string{}
+		for _, id := range pending.TicketsID {
+			if id != ticketID {
+				ticketsID = append(ticketsID, id)
+			}
+		}
+		// Not from this sync.
+		if len(ticketsID) == len(pending.TicketsID) {
+			syncs = append(syncs, pending)
+			continue
+		}
+		if !ok {
+			log.Printf("\tTicket %v not successful, changed products will be synced again.", ticketID)
+			requeueChangedProducts(pending.Products, time.Now())
+			continue
+		}
+		pending.TicketsID = ticketsID
+		if len(ticketsID) > 0 {
+			syncs = append(syncs, pending)
+		}
+	}
+	changedProductsSyncs = syncs
+}
+
+// Sync products that stop changing, and save resume token synced.
+func syncChangedProducts(ctx context.Context) {
+	defer changeStreamWorkers.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	savedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Products to sync.
+		muxChangedProducts.Lock()
+		products := map[string]*changedProduct{}
+		productsID := []string{}
+		for id, product := range changedProducts {
+			if time.Since(product.ChangedAt) > CHANGE_STREAM_DEBOUNCE_S*time.Second {
+				products[id] = product
+				productsID = append(productsID, id)
+				delete(changedProducts, id)
+			}
+		}
+		muxChangedProducts.Unlock()
+
+		if len(productsID) > 0 {
+			ticketsID, ok := syncProductsByID(ctx, productsID)
+			muxChangedProducts.Lock()
+			if !ok {
+				// Try again later.
+				requeueChangedProducts(products, time.Now())
+			} else if len(ticketsID) > 0 {
+				changedProductsSyncs = append(changedProductsSyncs, &changedProductsSync{TicketsID: ticketsID, Products: products})
+			}
+			muxChangedProducts.Unlock()
+		}
+
+		// Events before oldest event not synced are synced.
+		if time.Since(savedAt) < CHANGE_STREAM_SAVE_TOKEN_S*time.Second {
+			continue
+		}
+		muxChangedProducts.Lock()
+		token := changeStreamSyncedToken()
+		muxChangedProducts.Unlock()
+		if token != nil && !bytes.Equal(token, changeStreamSavedToken) {
+			if saveChangeStreamResumeToken(token) {
+				changeStreamSavedToken = token
+			}
+		}
+		savedAt = time.Now()
+	}
+}
+
+// Sync products with Zoom, tickets sent are returned.
+func syncProductsByID(ctx context.Context, productsID []string) (ticketsID []string, ok bool) {
+	muxUpdateZoomProducts.Lock()
+	defer muxUpdateZoomProducts.Unlock()
+
+	sort.Strings(productsID)
+	log.Printf(":: Products changed (%d): %s", len(productsID), strings.Join(productsID, ", "))
+
+	zunkaProducts, skippedID, err := getZunkaProductsByID(ctx, productsID)
+	if checkError(err) {
+		return nil, false
+	}
+	// Products removed from db, products that could not be decoded are not removed.
+	for _, id := range productsID {
+		found := false
+		for _, skipped := range skippedID {
+			if skipped == id {
+				found = true
+				break
+			}
+		}
+		for _, product := range zunkaProducts {
+			if product.ID == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			zunkaProducts = append(zunkaProducts, productZoom{
+				ID:           id,
+				NeverExisted: true,
+				PublishState: PUBLISH_STATE_DELETED,
+			})
+		}
+	}
+
+	zoomProdA, ok := filterZunkaProductsDiffFromZoomProduct(ctx, zunkaProducts)
+	if !ok {
+		return nil, false
+	}
+	if len(zoomProdA) == 0 {
+		log.Println("\tNo products to sync.")
+		return nil, true
+	}
+	c := make(chan zoomTicketIDOk)
+	go updateZoomProducts(ctx, zoomProdA, c)
+	go removeZoomProducts(ctx, zoomProdA, c)
+	ok = true
+	for _, result := range []zoomTicketIDOk{<-c, <-c} {
+		if !result.Ok {
+			ok = false
+		}
+		if result.TicketID != "" {
+			ticketsID = append(ticketsID, result.TicketID)
+		}
+	}
+	return ticketsID, ok
+}
+
+// Get change stream resume token from db.
+func getChangeStreamResumeToken() bson.Raw {
+	collection := client.Database("zunka").Collection("params")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var result struct {
+		Value bson.Raw `bson:"value"`
+	}
+	err := collection.FindOne(ctx, bson.M{"name": CHANGE_STREAM_RESUME_TOKEN}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if checkError(err) {
+		return nil
+	}
+	return result.Value
+}
+
+// Save change stream resume token into db.
+func saveChangeStreamResumeToken(token bson.Raw) bool {
+	collection := client.Database("zunka").Collection("params")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	filter := bson.M{"name": CHANGE_STREAM_RESUME_TOKEN}
+	update := bson.M{
+		"$set": bson.M{"value": token},
+	}
+	_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return !checkError(err)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestProductChangeAffectZoom(t *testing.T) {
+	update := func(updated bson.M, removed ...string) *productChangeEvent {
+		event := &productChangeEvent{OperationType: "update"}
+		event.UpdateDescription.UpdatedFields = updated
+		event.UpdateDescription.RemovedFields = removed
+		return event
+	}
+
+	tests := []struct {
+		name  string
+		event *productChangeEvent
+		want  bool
+	}{
+		{"insert", &productChangeEvent{OperationType: "insert"}, true},
+		{"replace", &productChangeEvent{OperationType: "replace"}, true},
+		{"delete", &productChangeEvent{OperationType: "delete"}, true},
+		{"price", update(bson.M{"storeProductPrice": 10.0, "updatedAt": 1}), true},
+		{"nested image", update(bson.M{"images.0": "a.webp"}), true},
+		{"removed field", update(bson.M{}, "storeProductWeight"), true},
+		{"only updated at", update(bson.M{"updatedAt": 1}), false},
+		{"not projected", update(bson.M{"storeProductViews": 1}, "storeProductNotes"), false},
+	}
+	for _, tt := range tests {
+		if got := productChangeAffectZoom(tt.event); got != tt.want {
+			t.Errorf("%s: productChangeAffectZoom() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Reset change stream state, restored at test end.
+func setChangeStreamTest(t *testing.T) {
+	oldProducts, oldSyncs, oldToken, oldSeq := changedProducts, changedProductsSyncs, changeStreamResumeToken, changeStreamSeq
+	t.Cleanup(func() {
+		changedProducts, changedProductsSyncs, changeStreamResumeToken, changeStreamSeq = oldProducts, oldSyncs, oldToken, oldSeq
+	})
+	changedProducts = map[string]*changedProduct{}
+	changedProductsSyncs = []*changedProductsSync{}
+	changeStreamResumeToken = bson.Raw{0}
+	changeStreamSeq = 0
+}
+
+func TestChangeStreamSyncedToken(t *testing.T) {
+	setChangeStreamTest(t)
+	now := time.Now()
+
+	// Events not affecting Zoom are synced.
+	productChanged("a", false, bson.Raw{1}, now)
+	if got := changeStreamSyncedToken(); got[0] != 1 {
+		t.Errorf("token = %v, want 1", got)
+	}
+	// Token before first event not synced, under continuous changes.
+	productChanged("a", true, bson.Raw{2}, now)
+	productChanged("b", true, bson.Raw{3}, now)
+	productChanged("a", true, bson.Raw{4}, now)
+	if got := changeStreamSyncedToken(); got[0] != 1 {
+		t.Errorf("token = %v, want 1", got)
+	}
+	// Product a synced, waiting ticket.
+	changedProductsSyncs = append(changedProductsSyncs, &changedProductsSync{TicketsID: []string{"t1"}, Products: map[string]*changedProduct{"a": changedProducts["a"]}})
+	delete(changedProducts, "a")
+	if got := changeStreamSyncedToken(); got[0] != 1 {
+		t.Errorf("token = %v, want 1 while ticket not finished", got)
+	}
+	changeStreamTicketFinished("t1", true)
+	if got := changeStreamSyncedToken(); got[0] != 2 {
+		t.Errorf("token = %v, want 2 before product b first event", got)
+	}
+	delete(changedProducts, "b")
+	if got := changeStreamSyncedToken(); got[0] != 4 {
+		t.Errorf("token = %v, want last token 4", got)
+	}
+}
+
+func TestChangeStreamTicketFailedRequeue(t *testing.T) {
+	setChangeStreamTest(t)
+	now := time.Now()
+
+	productChanged("a", true, bson.Raw{1}, now)
+	productChanged("b", true, bson.Raw{2}, now)
+	synced := changedProducts
+	changedProducts = map[string]*changedProduct{}
+	changedProductsSyncs = append(changedProductsSyncs, &changedProductsSync{TicketsID: []string{"t1", "t2"}, Products: synced})
+	// Product a changed again after sync.
+	productChanged("a", true, bson.Raw{3}, now)
+
+	changeStreamTicketFinished("other", false)
+	if len(changedProductsSyncs) != 1 || len(changedProducts) != 1 {
+		t.Fatalf("other ticket changed syncs %d, changed products %d", len(changedProductsSyncs), len(changedProducts))
+	}
+	changeStreamTicketFinished("t1", true)
+	changeStreamTicketFinished("t2", false)
+	if len(changedProductsSyncs) != 0 {
+		t.Errorf("syncs = %d, want 0", len(changedProductsSyncs))
+	}
+	if len(changedProducts) != 2 {
+		t.Fatalf("changed products = %v, want a and b", changedProducts)
+	}
+	// Requeued products keep first event not synced.
+	if changedProducts["a"].Seq != 1 || changedProducts["b"].Seq != 2 {
+		t.Errorf("seq a = %d, b = %d, want 1, 2", changedProducts["a"].Seq, changedProducts["b"].Seq)
+	}
+	if got := changeStreamSyncedToken(); got[0] != 0 {
+		t.Errorf("token = %v, want 0", got)
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const CLI_REQUEST_TIMEOUT_S = 60
+
+const cliUsage = `Usage: zoomproducts [command]
+
+Without command, or with other args like dev, run the server.
+
+Commands:
+  zoom list [--active] [--json]          List products at Zoom.
+  zoom get ID [--json]                   Show product at Zoom.
+  zoom receipt TICKET [--json]           Show ticket receipt.
+  zoom remove ID... [--json]             Remove products from Zoom.
+  zoom watch ID [--interval 5m]          Show product active status at Zoom periodically.
+  compare ID [--json]                    Compare product at Zunka and at Zoom.
+  export [--format csv|jsonl] [--output FILE]
+                                         Export catalog, Zunka and Zoom sides of each product.
+  market-zoom enable|disable [--ids ID,...] [--ids-file FILE] [--category CATEGORY] [--query JSON] [--dry-run] [--json]
+                                         Set or clear marketZoom for products selected by all informed filters.
+  marketplace NAME reconcile [--dry-run] [--json]
+                                         Send to marketplace products differences, like fake, Zoom is synced by server jobs.
+  prices [--check] [--json]              Products with Zoom price above lowest competitor offer, --check get offers first.
+  prices ID [--json]                     Product price history.
+  notify-test [--message TEXT]           Send test alert to configured notifiers.
+`
+
+// Commands, other args run the server, like dev used by start-dev-auto-reload.sh.
+var commands = map[string]bool{
+	"zoom":        true,
+	"compare":     true,
+	"export":      true,
+	"market-zoom": true,
+	"marketplace": true,
+	"prices":      true,
+	"notify-test": true,
+	"help":        true,
+	"-h":          true,
+	"--help":      true,
+}
+
+// Check if running a command instead of the server.
+func isCommand() bool {
+	return len(os.Args) > 1 && commands[os.Args[1]]
+}
+
+// Run command and exit.
+func runCommand(args []string) {
+	var err error
+	switch args[0] {
+	case "zoom":
+		err = runZoomCommand(args[1:])
+	case "compare":
+		err = runCompareCommand(args[1:])
+	case "export":
+		err = runExportCommand(args[1:])
+	case "market-zoom":
+		err = runMarketZoomCommand(args[1:])
+	case "marketplace":
+		err = runMarketplaceCommand(args[1:])
+	case "prices":
+		err = runPricesCommand(args[1:])
+	case "notify-test":
+		err = runNotifyTestCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(cliUsage)
+	default:
+		err = errors.New("Unknown command " + args[0])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Run 'zoomproducts help' for usage.")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// Run zoom command.
+func runZoomCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Missing zoom command")
+	}
+	fs := flag.NewFlagSet("zoom "+args[0], flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "JSON output")
+	active := fs.Bool("active", false, "Only active products")
+	interval := fs.Duration("interval", 5*time.Minute, "Watch interval")
+	ids, err := parseCommandFlags(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	// Canceled by ctrl-c.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	switch args[0] {
+	case "list":
+		return zoomListCommand(ctx, *active, *jsonOutput)
+	case "get":
+		if len(ids) != 1 {
+			return errors.New("Missing product id")
+		}
+		return zoomGetCommand(ctx, ids[0], *jsonOutput)
+	case "receipt":
+		if len(ids) != 1 {
+			return errors.New("Missing ticket")
+		}
+		return zoomReceiptCommand(ctx, ids[0], *jsonOutput)
+	case "remove":
+		if len(ids) == 0 {
+			return errors.New("Missing product id")
+		}
+		return zoomRemoveCommand(ctx, ids, *jsonOutput)
+	case "watch":
+		if len(ids) != 1 {
+			return errors.New("Missing product id")
+		}
+		return zoomWatchCommand(ctx, ids[0], *interval)
+	}
+	return errors.New("Unknown zoom command " + args[0])
+}
+
+// Run compare command.
+func runCompareCommand(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "JSON output")
+	ids, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	return compareCommand(ids, *jsonOutput)
+}
+
+// Run export command.
+func runExportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", EXPORT_FORMAT_CSV, "Output format, csv or jsonl")
+	output := fs.String("output", "", "Output file, stdout if empty")
+	if _, err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	if *format != EXPORT_FORMAT_CSV && *format != EXPORT_FORMAT_JSONL {
+		return errors.New("Invalid format " + *format)
+	}
+	connectMongo()
+	ctx, cancel := context.WithTimeout(context.Background(), CLI_REQUEST_TIMEOUT_S*time.Second)
+	defer cancel()
+	rows, err := getCatalog(ctx)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return writeCatalog(os.Stdout, rows, *format)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return writeCatalog(file, rows, *format)
+}
+
+// Run marketplace command.
+func runMarketplaceCommand(args []string) error {
+	if len(args) < 2 || args[1] != "reconcile" {
+		return errors.New("Missing marketplace name or reconcile")
+	}
+	fs := flag.NewFlagSet("marketplace", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Show differences without send it")
+	jsonOutput := fs.Bool("json", false, "JSON output")
+	if _, err := parseCommandFlags(fs, args[2:]); err != nil {
+		return err
+	}
+	ms, err := getReconcileMarketplace(args[0])
+	if err != nil {
+		return err
+	}
+	connectMongo()
+	ctx, cancel := context.WithTimeout(context.Background(), CLI_REQUEST_TIMEOUT_S*time.Second)
+	defer cancel()
+	run, err := ms.reconcile(ctx, *dryRun)
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(run)
+	}
+	fmt.Printf("Upserted (%d): %s\n", len(run.Upserted), strings.Join(run.Upserted, ", "))
+	fmt.Printf("Deleted (%d): %s\n", len(run.Deleted), strings.Join(run.Deleted, ", "))
+	if len(run.Tickets) > 0 {
+		fmt.Printf("Tickets: %s\n", strings.Join(run.Tickets, ", "))
+	}
+	return nil
+}
+
+// Run notify-test command.
+func runNotifyTestCommand(args []string) error {
+	fs := flag.NewFlagSet("notify-test", flag.ContinueOnError)
+	message := fs.String("message", "Alert test.", "Alert message")
+	if _, err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	if len(notifiers) == 0 {
+		return errors.New("No notifier configured")
+	}
+	a := &alert{Key: "test", Subject: "Test", Message: *message, CreatedAt: time.Now()}
+	if !notifyAll(a) {
+		return errors.New("Could not send alert by all notifiers")
+	}
+	for _, n := range notifiers {
+		fmt.Printf("Sent by %s\n", n.name())
+	}
+	return nil
+}
+
+// Run prices command.
+func runPricesCommand(args []string) error {
+	fs := flag.NewFlagSet("prices", flag.ContinueOnError)
+	check := fs.Bool("check", false, "Get competitor offers before report")
+	jsonOutput := fs.Bool("json", false, "JSON output")
+	ids, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 1 {
+		return errors.New("Only one product id allowed")
+	}
+	connectMongo()
+	ctx, cancel := context.WithTimeout(context.Background(), CLI_REQUEST_TIMEOUT_S*time.Second)
+	defer cancel()
+	if *check {
+		if err = checkPrices(ctx); err != nil {
+			return err
+		}
+	}
+	checks := []priceCheck{}
+	if len(ids) == 1 {
+		checks, err = getPriceHistory(ctx, ids[0])
+	} else {
+		checks, err = getPriceReport(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(checks)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPRICE\tLOWEST\tSELLER\tABOVE %\tSUGGESTED\tCHECKED AT")
+	for _, c := range checks {
+		suggested := ""
+		if c.SuggestedPrice > 0 {
+			suggested = fmt.Sprintf("%.2f", c.SuggestedPrice)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%.2f\t%s\t%.2f\t%s\t%s\n", c.ProductID, cliTruncate(c.Name), c.Price, c.LowestPrice, c.LowestSeller, c.AbovePercent, suggested, c.CheckedAt.In(brLocation).Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// Run market-zoom command.
+func runMarketZoomCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "enable" && args[0] != "disable") {
+		return errors.New("Missing enable or disable")
+	}
+	fs := flag.NewFlagSet("market-zoom", flag.ContinueOnError)
+	ids := fs.String("ids", "", "Products id, comma separated")
+	idsFile := fs.String("ids-file", "", "CSV file with products id at first column")
+	category := fs.String("category", "", "Products category")
+	query := fs.String("query", "", "MongoDB filter as JSON")
+	dryRun := fs.Bool("dry-run", false, "Show products to change without change it")
+	jsonOutput := fs.Bool("json", false, "JSON output")
+	if _, err := parseCommandFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	change := marketZoomChange{
+		Enable:   args[0] == "enable",
+		Category: *category,
+		Query:    *query,
+		DryRun:   *dryRun,
+		User:     os.Getenv("USER"),
+	}
+	if *ids != "" {
+		for _, id := range strings.Split(*ids, ",") {
+			change.IDs = append(change.IDs, strings.TrimSpace(id))
+		}
+	}
+	if *idsFile != "" {
+		file, err := os.Open(*idsFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		fileIDs, err := readMarketZoomIDs(file)
+		if err != nil {
+			return err
+		}
+		if len(fileIDs) == 0 {
+			return errors.New("No products id at " + *idsFile)
+		}
+		change.IDs = append(change.IDs, fileIDs...)
+	}
+	if _, err := marketZoomFilter(&change); err != nil {
+		return err
+	}
+
+	connectMongo()
+	ctx, cancel := context.WithTimeout(context.Background(), CLI_REQUEST_TIMEOUT_S*time.Second)
+	defer cancel()
+	result, err := changeMarketZoom(ctx, &change)
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(result)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTITLE")
+	for _, product := range result.Products {
+		fmt.Fprintf(w, "%s\t%s\n", product.ID, product.Title)
+	}
+	w.Flush()
+	if result.DryRun {
+		fmt.Printf("\nDry run, products matched: %d, to change: %d\n", result.Matched, result.Changed)
+	} else {
+		fmt.Printf("\nProducts matched: %d, changed: %d\n", result.Matched, result.Changed)
+	}
+	return nil
+}
+
+// Parse flags before or after arguments, return arguments, all after "--" are arguments.
+func parseCommandFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	result := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		parsed := len(args) - fs.NArg()
+		if parsed > 0 && args[parsed-1] == "--" {
+			return append(result, fs.Args()...), nil
+		}
+		if fs.NArg() == 0 {
+			return result, nil
+		}
+		result = append(result, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// List zoom products.
+func zoomListCommand(ctx context.Context, active bool, jsonOutput bool) error {
+	products, err := cliZoomProducts(ctx)
+	if err != nil {
+		return err
+	}
+	if active {
+		activeProducts := []productZoomR{}
+		for _, product := range products {
+			if product.Active {
+				activeProducts = append(activeProducts, product)
+			}
+		}
+		products = activeProducts
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	if jsonOutput {
+		return printJSON(products)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tACTIVE\tPRICE\tQUANTITY\tFREE SHIPPING\tNAME")
+	for _, product := range products {
+		fmt.Fprintf(w, "%s\t%v\t%.2f\t%d\t%v\t%s\n", product.ID, product.Active, product.Price, product.Quantity, product.FreeShipping, product.Name)
+	}
+	return w.Flush()
+}
+
+// Show zoom product.
+func zoomGetCommand(ctx context.Context, productID string, jsonOutput bool) error {
+	product, err := cliZoomProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(product)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\t%s\n", product.ID)
+	fmt.Fprintf(w, "Name\t%s\n", product.Name)
+	fmt.Fprintf(w, "Active\t%v\n", product.Active)
+	fmt.Fprintf(w, "Price\t%.2f\n", product.Price)
+	fmt.Fprintf(w, "Quantity\t%d\n", product.Quantity)
+	fmt.Fprintf(w, "Free shipping\t%v\n", product.FreeShipping)
+	fmt.Fprintf(w, "Url\t%s\n", product.Url)
+	return w.Flush()
+}
+
+// Show ticket receipt.
+func zoomReceiptCommand(ctx context.Context, ticketID string, jsonOutput bool) error {
+	ctx, cancel := context.WithTimeout(ctx, CLI_REQUEST_TIMEOUT_S*time.Second)
+	defer cancel()
+	receipt, err := getZoomReceipt(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(receipt)
+	}
+	fmt.Printf("Finished: %v\n", receipt.Finished)
+	fmt.Printf("Quantity: %d\n", receipt.Quantity)
+	fmt.Printf("Requested at: %s\n\n", receipt.RequestTimestamp.Format("2006-01-02 15:04:05"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PRODUCT ID\tSTATUS\tMESSAGE\tWARNINGS")
+	for _, result := range receipt.Results {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", result.ProductID, result.Status, result.Message, strings.Join(result.WarnMessages, "; "))
+	}
+	return w.Flush()
+}
+
+// Remove products from zoom.
+func zoomRemoveCommand(ctx context.Context, productsID []string, jsonOutput bool) error {
+	ctx, cancel := context.WithTimeout(ctx, CLI_REQUEST_TIMEOUT_S*time.Second)
+	defer cancel()
+	ticket, err := requestDeleteZoomProducts(ctx, productsID)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(ticket)
+	}
+	fmt.Printf("Ticket: %s\n", ticket.ID)
+	fmt.Println("Products still marked to Zoom at Zunka will be created again by the server.")
+	return nil
+}
+
+// Show product active status periodically.
+func zoomWatchCommand(ctx context.Context, productID string, interval time.Duration) error {
+	for {
+		product, err := cliZoomProduct(ctx, productID)
+		if ctx.Err() != nil {
+			return nil
+		}
+		now := time.Now().Format("2006-01-02 15:04:05")
+		if err != nil {
+			fmt.Printf("%s\terror: %v\n", now, err)
+		} else {
+			fmt.Printf("%s\tactive: %v\n", now, product.Active)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Get zoom products.
+func cliZoomProducts(ctx context.Context) ([]productZoomR, error) {
+	ctx, cancel := context.WithTimeout(ctx, CLI_REQUEST_TIMEOUT_S*time.Second)
+	defer cancel()
+	c := make(chan productZoomRAOk)
+	go getZoomProducts(ctx, c)
+	result := <-c
+	if !result.Ok {
+		return nil, errors.New("Could not get products from Zoom")
+	}
+	return *result.Products, nil
+}
+
+// Get zoom product.
+func cliZoomProduct(ctx context.Context, productID string) (product productZoomR, err error) {
+	products, err := cliZoomProducts(ctx)
+	if err != nil {
+		return product, err
+	}
+	for _, product := range products {
+		if product.ID == productID {
+			return product, nil
+		}
+	}
+	return product, errors.New("Product not found at Zoom: " + productID)
+}
+
+// Print value as indented json.
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantArgs   string
+		wantJSON   bool
+		wantFormat string
+		wantErr    bool
+	}{
+		{"no args", nil, "", false, "csv", false},
+		{"flags before args", []string{"-json", "-format", "jsonl", "a", "b"}, "a,b", true, "jsonl", false},
+		{"flags after args", []string{"a", "b", "-json", "-format=jsonl"}, "a,b", true, "jsonl", false},
+		{"flags between args", []string{"a", "-json", "b", "-format", "jsonl", "c"}, "a,b,c", true, "jsonl", false},
+		{"terminator", []string{"a", "--", "-json", "b"}, "a,-json,b", false, "csv", false},
+		{"unknown flag", []string{"a", "-other"}, "", false, "csv", true},
+		{"missing flag value", []string{"a", "-format"}, "", false, "csv", true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		jsonOutput := fs.Bool("json", false, "")
+		format := fs.String("format", "csv", "")
+		args, err := parseCommandFlags(fs, tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseCommandFlags() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if strings.Join(args, ",") != tt.wantArgs || *jsonOutput != tt.wantJSON || *format != tt.wantFormat {
+			t.Errorf("%s: args = %v, json = %v, format = %s, want %s, %v, %s", tt.name, args, *jsonOutput, *format, tt.wantArgs, tt.wantJSON, tt.wantFormat)
+		}
+	}
+}
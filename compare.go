@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Compared field.
+type compareField struct {
+	Field  string `json:"field"`
+	Zunka  string `json:"zunka"`
+	ToZoom string `json:"toZoom"`
+	AtZoom string `json:"atZoom"`
+	Diff   bool   `json:"diff"`
+}
+
+// Product at Zunka and at Zoom.
+type productCompare struct {
+	ID               string         `json:"id"`
+	PublishState     string         `json:"publishState"`
+	ValidationErrors []string       `json:"validationErrors"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+	DeletedAt        time.Time      `json:"deletedAt"`
+	Zunka            *productZunka  `json:"zunka"`
+	ToZoom           *productZoom   `json:"toZoom"`
+	AtZoom           *productZoomR  `json:"atZoom"`
+	Fields           []compareField `json:"fields"`
+	LastTicket       []syncHistory  `json:"lastTicket"`
+}
+
+// Compare product at Zunka and at Zoom.
+func compareCommand(args []string, jsonOutput bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Missing product id")
+	}
+	connectMongo()
+	ctx, cancel := context.WithTimeout(context.Background(), CLI_REQUEST_TIMEOUT_S*time.Second)
+	defer cancel()
+
+	prodZunka, err := getZunkaProduct(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	prodZoom := convertProductZunkaToZoom(prodZunka)
+	products, err := cliZoomProducts(ctx)
+	if err != nil {
+		return err
+	}
+	var prodZoomR *productZoomR
+	for i := range products {
+		if products[i].ID == prodZoom.ID {
+			prodZoomR = &products[i]
+			break
+		}
+	}
+	history, err := getSyncHistory(prodZoom.ID)
+	if err != nil {
+		return err
+	}
+
+	result := productCompare{
+		ID:               prodZoom.ID,
+		PublishState:     prodZoom.PublishState.String(),
+		ValidationErrors: prodZoom.ValidationErrors,
+		UpdatedAt:        prodZoom.UpdatedAt,
+		DeletedAt:        prodZoom.DeletedAt,
+		Zunka:            prodZunka,
+		ToZoom:           prodZoom,
+		AtZoom:           prodZoomR,
+		Fields:           compareFields(prodZunka, prodZoom, prodZoomR),
+		LastTicket:       lastTicketHistory(history),
+	}
+	if jsonOutput {
+		return printJSON(result)
+	}
+	printProductCompare(&result)
+	return nil
+}
+
+// Get Zunka product.
+func getZunkaProduct(ctx context.Context, productID string) (*productZunka, error) {
+	objectID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, err
+	}
+	collection := client.Database("zunka").Collection("products")
+	prodZunka := productZunka{}
+	findOptions := options.FindOne().SetProjection(zunkaProductProjection)
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}, findOptions).Decode(&prodZunka)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get Zunka product %s. %v", productID, err)
+	}
+	return &prodZunka, nil
+}
+
+// Field by field comparison, only fields returned by Zoom are compared.
+func compareFields(prodZunka *productZunka, p *productZoom, pr *productZoomR) []compareField {
+	atZoom := func(f func(pr *productZoomR) string) string {
+		if pr == nil {
+			return "-"
+		}
+		return f(pr)
+	}
+	zoomFreeShipping := "-"
+	if prodZunka.ZoomFreeShipping != nil {
+		zoomFreeShipping = fmt.Sprint(*prodZunka.ZoomFreeShipping)
+	}
+	zoomCrossDocking := "-"
+	if prodZunka.ZoomCrossDocking != nil {
+		zoomCrossDocking = fmt.Sprint(*prodZunka.ZoomCrossDocking)
+	}
+	fields := []compareField{
+		{"active", fmt.Sprintf("commercialize: %v, marketZoom: %v", prodZunka.Commercialize, prodZunka.MarketZoom), fmt.Sprint(p.PublishState.upsert()),
+			atZoom(func(pr *productZoomR) string { return fmt.Sprint(pr.Active) }), pr == nil && p.PublishState.upsert() || pr != nil && pr.Active != p.PublishState.upsert()},
+		{"name", prodZunka.Name, p.Name,
+			atZoom(func(pr *productZoomR) string { return pr.Name }), pr != nil && pr.Name != p.Name},
+		{"price", fmt.Sprintf("%.2f", prodZunka.Price), fmt.Sprintf("%.2f", p.Price),
+			atZoom(func(pr *productZoomR) string { return fmt.Sprintf("%.2f", pr.Price) }), pr != nil && math.Abs(pr.Price-p.Price) > 0.10},
+		{"base_price", "", fmt.Sprintf("%.2f", p.BasePrice),
+			atZoom(func(pr *productZoomR) string { return fmt.Sprintf("%.2f", pr.BasePrice) }), pr != nil && math.Abs(pr.BasePrice-p.BasePrice) > 0.10},
+		{"installments", "", fmt.Sprintf("%dx %.2f", p.Installments.AmountMonths, p.Installments.Price),
+			atZoom(func(pr *productZoomR) string {
+				return fmt.Sprintf("%dx %.2f", pr.Installments.AmountMonths, pr.Installments.Price)
+			}), pr != nil && (pr.Installments.AmountMonths != p.Installments.AmountMonths || math.Abs(pr.Installments.Price-p.Installments.Price) > 0.10)},
+		{"quantity", fmt.Sprint(prodZunka.Quantity), fmt.Sprint(p.Quantity),
+			atZoom(func(pr *productZoomR) string { return fmt.Sprint(pr.Quantity) }), pr != nil && pr.Quantity != p.Quantity},
+		{"free_shipping", zoomFreeShipping, fmt.Sprint(p.FreeShipping),
+			atZoom(func(pr *productZoomR) string { return fmt.Sprint(pr.FreeShipping) }), pr != nil && pr.FreeShipping != p.FreeShipping},
+		{"url", "", p.Url,
+			atZoom(func(pr *productZoomR) string { return pr.Url }), pr != nil && pr.Url != p.Url},
+		// Not returned by Zoom.
+		{"cross_docking", zoomCrossDocking, fmt.Sprint(p.Dimensions.CrossDocking), "", false},
+		{"ean", prodZunka.EAN, p.EAN, "", false},
+		{"sub_department", prodZunka.Category, p.SubDepartment, "", false},
+		{"images", strings.Join(prodZunka.Images, ", "), fmt.Sprint(len(p.UrlImages)), "", false},
+		// Payload changed since last sent.
+		{"payload_hash", prodZunka.ZoomStatus.PayloadHash, payloadHash(p), "", p.PublishState.upsert() && prodZunka.ZoomStatus.PayloadHash != payloadHash(p)},
+	}
+	return fields
+}
+
+// History from last ticket, oldest first.
+func lastTicketHistory(history []syncHistory) []syncHistory {
+	result := []syncHistory{}
+	ticketID := ""
+	// History is newest first.
+	for _, h := range history {
+		if h.TicketID == "" {
+			continue
+		}
+		if ticketID == "" {
+			ticketID = h.TicketID
+		}
+		if h.TicketID == ticketID {
+			result = append([]syncHistory{h}, result...)
+		}
+	}
+	return result
+}
+
+// Print product comparison.
+func printProductCompare(result *productCompare) {
+	fmt.Printf("Product: %s\n", result.ID)
+	fmt.Printf("Publish state: %s\n", result.PublishState)
+	if len(result.ValidationErrors) > 0 {
+		fmt.Printf("Validation errors: %s\n", strings.Join(result.ValidationErrors, ", "))
+	}
+	fmt.Printf("Updated at: %s\n", result.UpdatedAt.In(brLocation).Format("2006-01-02 15:04:05"))
+	if !result.DeletedAt.IsZero() {
+		fmt.Printf("Deleted at: %s\n", result.DeletedAt.In(brLocation).Format("2006-01-02 15:04:05"))
+	}
+	if result.AtZoom == nil {
+		fmt.Println("Not found at Zoom")
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tFIELD\tZUNKA\tTO ZOOM\tAT ZOOM")
+	for _, field := range result.Fields {
+		mark := ""
+		if field.Diff {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", mark, field.Field, cliTruncate(field.Zunka), cliTruncate(field.ToZoom), cliTruncate(field.AtZoom))
+	}
+	w.Flush()
+	fmt.Println()
+
+	if len(result.LastTicket) == 0 {
+		fmt.Println("No ticket at history")
+		return
+	}
+	fmt.Printf("Last ticket: %s\n", result.LastTicket[0].TicketID)
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tACTION\tSTATUS\tMESSAGE")
+	for _, h := range result.LastTicket {
+		status := ""
+		if h.Status != 0 {
+			status = fmt.Sprint(h.Status)
+		}
+		message := h.Message
+		if len(h.WarnMessages) > 0 {
+			message = strings.TrimSpace(message + " " + strings.Join(h.WarnMessages, "; "))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", h.CreatedAt.In(brLocation).Format("2006-01-02 15:04:05"), h.Action, status, message)
+	}
+	w.Flush()
+}
+
+// Truncate long values for table.
+func cliTruncate(s string) string {
+	const max = 60
+	if len([]rune(s)) > max {
+		return string([]rune(s)[:max-3]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareFields(t *testing.T) {
+	freeShipping := true
+	prodZunka := &productZunka{Name: "Notebook", Price: 1000, Quantity: 2, Commercialize: true, MarketZoom: true, ZoomFreeShipping: &freeShipping}
+	newProducts := func() (*productZoom, *productZoomR) {
+		p := &productZoom{Name: "Notebook", Price: 1100, Quantity: 2, FreeShipping: true, Url: "https://www.zunka.com.br/product/1", PublishState: PUBLISH_STATE_PUBLISHABLE}
+		p.Installments.AmountMonths = 10
+		p.Installments.Price = 110
+		pr := &productZoomR{Name: p.Name, Price: p.Price, Quantity: p.Quantity, FreeShipping: p.FreeShipping, Url: p.Url, Active: true}
+		pr.Installments.AmountMonths = 10
+		pr.Installments.Price = 110
+		return p, pr
+	}
+	tests := []struct {
+		name     string
+		change   func(p *productZoom, pr *productZoomR) *productZoomR
+		wantDiff string // Fields with diff, comma separated.
+	}{
+		{"same", func(p *productZoom, pr *productZoomR) *productZoomR { return pr }, ""},
+		{"not at Zoom", func(p *productZoom, pr *productZoomR) *productZoomR { return nil }, "active"},
+		{"removed not at Zoom", func(p *productZoom, pr *productZoomR) *productZoomR {
+			p.PublishState = PUBLISH_STATE_UNMARKED
+			return nil
+		}, ""},
+		{"inactive at Zoom", func(p *productZoom, pr *productZoomR) *productZoomR {
+			pr.Active = false
+			return pr
+		}, "active"},
+		{"removed active at Zoom", func(p *productZoom, pr *productZoomR) *productZoomR {
+			p.PublishState = PUBLISH_STATE_UNMARKED
+			return pr
+		}, "active"},
+		{"price rounding", func(p *productZoom, pr *productZoomR) *productZoomR {
+			pr.Price += 0.05
+			pr.Installments.Price -= 0.05
+			return pr
+		}, ""},
+		{"price and installments", func(p *productZoom, pr *productZoomR) *productZoomR {
+			pr.Price = 1000
+			pr.Installments.AmountMonths = 12
+			return pr
+		}, "price,installments"},
+		{"name, quantity, free shipping and url", func(p *productZoom, pr *productZoomR) *productZoomR {
+			pr.Name = "Old"
+			pr.Quantity = 1
+			pr.FreeShipping = false
+			pr.Url = ""
+			return pr
+		}, "name,quantity,free_shipping,url"},
+	}
+	for _, tt := range tests {
+		p, pr := newProducts()
+		pr = tt.change(p, pr)
+		// Payload sent, so only differences at Zoom.
+		prodZunka.ZoomStatus.PayloadHash = payloadHash(p)
+		diff := []string{}
+		for _, field := range compareFields(prodZunka, p, pr) {
+			if field.Diff {
+				diff = append(diff, field.Field)
+			}
+		}
+		if strings.Join(diff, ",") != tt.wantDiff {
+			t.Errorf("%s: fields with diff = %v, want %s", tt.name, diff, tt.wantDiff)
+		}
+	}
+}
+
+func TestCompareFieldsValues(t *testing.T) {
+	crossDocking := 3
+	prodZunka := &productZunka{Name: "Notebook", Price: 1000, ZoomCrossDocking: &crossDocking, Images: []string{"a.webp", "b.webp"}}
+	p := &productZoom{Name: "Notebook", Price: 1100, PublishState: PUBLISH_STATE_PUBLISHABLE, UrlImages: []urlImageZoom{{Url: "a"}, {Url: "b"}}}
+	p.Dimensions.CrossDocking = 3
+	fields := map[string]compareField{}
+	for _, field := range compareFields(prodZunka, p, nil) {
+		fields[field.Field] = field
+	}
+	tests := []compareField{
+		{"price", "1000.00", "1100.00", "-", false},
+		{"free_shipping", "-", "false", "-", false},
+		{"cross_docking", "3", "3", "", false},
+		{"images", "a.webp, b.webp", "2", "", false},
+		// Never sent.
+		{"payload_hash", "", payloadHash(p), "", true},
+	}
+	for _, want := range tests {
+		if got := fields[want.Field]; got != want {
+			t.Errorf("field %s = %+v, want %+v", want.Field, got, want)
+		}
+	}
+}
+
+func TestLastTicketHistory(t *testing.T) {
+	now := time.Now()
+	// Newest first.
+	history := []syncHistory{
+		{Action: "skipped", CreatedAt: now},
+		{Action: "receipt", TicketID: "t2", Status: 200, CreatedAt: now.Add(-time.Minute)},
+		{Action: "sent", TicketID: "t2", CreatedAt: now.Add(-2 * time.Minute)},
+		{Action: "receipt", TicketID: "t1", Status: 400, CreatedAt: now.Add(-3 * time.Minute)},
+		{Action: "sent", TicketID: "t1", CreatedAt: now.Add(-4 * time.Minute)},
+	}
+	tests := []struct {
+		name       string
+		history    []syncHistory
+		wantAction string // Actions from last ticket, oldest first.
+	}{
+		{"last ticket", history, "sent,receipt"},
+		{"ticket not finished", history[2:], "sent"},
+		{"without ticket", history[:1], ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		actions := []string{}
+		for _, h := range lastTicketHistory(tt.history) {
+			actions = append(actions, h.Action)
+		}
+		if strings.Join(actions, ",") != tt.wantAction {
+			t.Errorf("%s: lastTicketHistory() actions = %v, want %s", tt.name, actions, tt.wantAction)
+		}
+	}
+	if h := lastTicketHistory(history); len(h) != 2 || h[0].TicketID != "t2" || h[1].Status != 200 {
+		t.Errorf("lastTicketHistory() = %+v", h)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Configuration, loaded from json file.
+type zoomConfig struct {
+	Shipping     shippingConfig     `json:"shipping"`
+	Stock        stockConfig        `json:"stock"`
+	Reactivation reactivationConfig `json:"reactivation"`
+	Pricing      pricingConfig      `json:"pricing"`
+	Alerts       alertsConfig       `json:"alerts"`
+}
+
+// Free shipping and cross docking rules.
+type shippingConfig struct {
+	// Product have free shipping if match any rule.
+	FreeShippingRules []freeShippingRule `json:"freeShippingRules"`
+	CrossDocking      crossDockingConfig `json:"crossDocking"`
+}
+
+// Free shipping rule, match if all defined conditions match.
+type freeShippingRule struct {
+	MinPrice   float64  `json:"minPrice"`   // Zunka price.
+	MaxWeight  int      `json:"maxWeight"`  // KG.
+	Categories []string `json:"categories"` // Any of.
+}
+
+// Cross docking days.
+type crossDockingConfig struct {
+	Default  int            `json:"default"`
+	OwnStock int            `json:"ownStock"` // Product without dealer.
+	Dealers  map[string]int `json:"dealers"`  // By dealer name.
+}
+
+// Stock policy for quantity published to Zoom.
+type stockConfig struct {
+	Buffer          int            `json:"buffer"`          // Units not published.
+	CategoryBuffers map[string]int `json:"categoryBuffers"` // Buffer by category.
+	MaxQuantity     int            `json:"maxQuantity"`     // Max published, zero for no limit.
+	MinQuantity     int            `json:"minQuantity"`     // Unavailable below it.
+}
+
+// Remove product from Zoom and create it again after some time when fields change.
+type reactivationConfig struct {
+	Fields   []string `json:"fields"` // Zoom json field names, like name or ean, none to disable.
+	DelayMin int      `json:"delayMin"`
+}
+
+// Price competitiveness against competitor offers at Zoom.
+type pricingConfig struct {
+	OffersSource     string  `json:"offersSource"`     // Offers json file or url, empty to disable.
+	CheckIntervalMin int     `json:"checkIntervalMin"` // Offers check interval.
+	AbovePercent     float64 `json:"abovePercent"`     // Report Zoom price above lowest offer by more than it.
+	MinMarkupPercent float64 `json:"minMarkupPercent"` // Margin floor, suggested Zoom price over Zunka price.
+	Undercut         float64 `json:"undercut"`         // Suggested price below lowest offer.
+	Seller           string  `json:"seller"`           // Our seller name, our offers are ignored.
+}
+
+// Alerts thresholds, notifiers are configured by env.
+type alertsConfig struct {
+	QuietPeriodMin        int     `json:"quietPeriodMin"`        // Alert with same key is not sent again.
+	ConsistencyFailures   int     `json:"consistencyFailures"`   // Consistency passes failed in sequence, or with same product at diff.
+	ReceiptFailurePercent float64 `json:"receiptFailurePercent"` // Products failed by ticket.
+	ActiveDrift           int     `json:"activeDrift"`           // Active products at Zoom different from Zunka.
+}
+
+// Configuration.
+var config zoomConfig
+
+// Default configuration.
+func defaultConfig() zoomConfig {
+	return zoomConfig{
+		Shipping: shippingConfig{
+			FreeShippingRules: []freeShippingRule{},
+			CrossDocking: crossDockingConfig{
+				Default: 2,
+				Dealers: map[string]int{},
+			},
+		},
+		Stock: stockConfig{
+			CategoryBuffers: map[string]int{},
+		},
+		Reactivation: reactivationConfig{
+			Fields:   []string{},
+			DelayMin: 10,
+		},
+		Pricing: pricingConfig{
+			CheckIntervalMin: 60,
+			AbovePercent:     5,
+			Undercut:         0.01,
+			Seller:           "Zunka",
+		},
+		Alerts: alertsConfig{
+			QuietPeriodMin:        60,
+			ConsistencyFailures:   3,
+			ReceiptFailurePercent: 20,
+			ActiveDrift:           5,
+		},
+	}
+}
+
+// Load configuration file, use default configuration for missing file or values.
+func loadConfig(configFile string) {
+	config = defaultConfig()
+	data, err := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		log.Printf("No config file %s, using default configuration.", configFile)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		panic(err)
+	}
+	log.Printf("Config file: %s", configFile)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Export formats.
+const (
+	EXPORT_FORMAT_CSV   = "csv"
+	EXPORT_FORMAT_JSONL = "jsonl"
+)
+
+// Reconciled catalog row, Zunka and Zoom sides of one product.
+type catalogRow struct {
+	ID            string    `json:"id"`
+	Title         string    `json:"title"`
+	Price         float64   `json:"price"`
+	ZoomPrice     float64   `json:"zoomPrice"`
+	Quantity      int       `json:"quantity"`
+	ZoomQuantity  int       `json:"zoomQuantity"`
+	ZoomActive    bool      `json:"zoomActive"`
+	MarketZoom    bool      `json:"marketZoom"`
+	Commercialize bool      `json:"commercialize"`
+	PublishState  string    `json:"publishState"`
+	DeletedAt     time.Time `json:"deletedAt"`
+	Diff          string    `json:"diff"`
+	ZunkaNotFound bool      `json:"zunkaNotFound"`
+	ZoomNotFound  bool      `json:"zoomNotFound"`
+}
+
+// Get reconciled catalog, one row by product id.
+func getCatalog(ctx context.Context) ([]catalogRow, error) {
+	cZoomR := make(chan productZoomRAOk)
+	cZoomDb := make(chan productZoomAOk)
+	go getZoomProducts(ctx, cZoomR)
+	go getAllZunkaProducts(ctx, cZoomDb)
+	prodZoomDBAOk, prodZoomRAOK := <-cZoomDb, <-cZoomR
+	if !prodZoomDBAOk.Ok || !prodZoomRAOK.Ok {
+		return nil, errors.New("Could not get Zunka or Zoom products.")
+	}
+	zunkaProducts := *prodZoomDBAOk.Products
+
+	zoomProducts := map[string]productZoomR{}
+	for _, product := range *prodZoomRAOK.Products {
+		zoomProducts[product.ID] = product
+	}
+
+	// Products at Zoom deleted from Zunka.
+	zunkaProductsID := map[string]bool{}
+	for _, product := range zunkaProducts {
+		zunkaProductsID[product.ID] = true
+	}
+	deletedID := []string{}
+	for id := range zoomProducts {
+		if !zunkaProductsID[id] {
+			deletedID = append(deletedID, id)
+		}
+	}
+	if len(deletedID) > 0 {
+		// Zoom product id may be not a Zunka id.
+		deletedObjectID := []string{}
+		for _, id := range deletedID {
+			if _, err := primitive.ObjectIDFromHex(id); err == nil {
+				deletedObjectID = append(deletedObjectID, id)
+			}
+		}
+		deletedProducts, _, err := getZunkaProductsByID(ctx, deletedObjectID)
+		if err != nil {
+			return nil, err
+		}
+		zunkaProducts = append(zunkaProducts, deletedProducts...)
+		for _, product := range deletedProducts {
+			zunkaProductsID[product.ID] = true
+		}
+	}
+
+	rows := []catalogRow{}
+	for i := range zunkaProducts {
+		p := &zunkaProducts[i]
+		row := catalogRow{
+			ID:            p.ID,
+			Title:         p.Name,
+			Price:         p.ZunkaPrice,
+			Quantity:      p.ZunkaQuantity,
+			MarketZoom:    p.ZunkaMarketZoom,
+			Commercialize: p.ZunkaCommercialize,
+			PublishState:  p.PublishState.String(),
+			DeletedAt:     p.DeletedAt,
+		}
+		pr, ok := zoomProducts[p.ID]
+		if ok {
+			row.ZoomPrice = pr.Price
+			row.ZoomQuantity = pr.Quantity
+			row.ZoomActive = pr.Active
+		} else {
+			row.ZoomNotFound = true
+		}
+		// Same rules as consistency check, inactive at Zoom is considered removed.
+		switch {
+		case p.PublishState.remove() && pr.Active:
+			row.Diff = p.Diff(&pr)
+		case p.PublishState.upsert() && !ok:
+			row.Diff = "Not found at Zoom"
+		case p.PublishState.upsert():
+			row.Diff = p.Diff(&pr)
+		}
+		rows = append(rows, row)
+	}
+	// Products at Zoom never existed at Zunka.
+	for id, pr := range zoomProducts {
+		if zunkaProductsID[id] {
+			continue
+		}
+		row := catalogRow{
+			ID:            id,
+			Title:         pr.Name,
+			ZoomPrice:     pr.Price,
+			ZoomQuantity:  pr.Quantity,
+			ZoomActive:    pr.Active,
+			PublishState:  PUBLISH_STATE_DELETED.String(),
+			ZunkaNotFound: true,
+		}
+		if pr.Active {
+			row.Diff = "Not found at Zunka"
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	return rows, nil
+}
+
+// Write catalog as csv or json lines.
+func writeCatalog(w io.Writer, rows []catalogRow, format string) error {
+	switch format {
+	case EXPORT_FORMAT_CSV:
+		return writeCatalogCSV(w, rows)
+	case EXPORT_FORMAT_JSONL:
+		encoder := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Invalid export format %s, must be %s or %s", format, EXPORT_FORMAT_CSV, EXPORT_FORMAT_JSONL)
+}
+
+// Write catalog as csv.
+func writeCatalogCSV(w io.Writer, rows []catalogRow) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "title", "price", "zoom_price", "quantity", "zoom_quantity", "zoom_active", "market_zoom", "commercialize", "publish_state", "deleted_at", "diff"})
+	for _, row := range rows {
+		deletedAt := ""
+		if !row.DeletedAt.IsZero() {
+			deletedAt = row.DeletedAt.In(brLocation).Format("2006-01-02 15:04:05")
+		}
+		price, quantity, marketZoom, commercialize := "", "", "", ""
+		if !row.ZunkaNotFound {
+			price = strconv.FormatFloat(row.Price, 'f', 2, 64)
+			quantity = strconv.Itoa(row.Quantity)
+			marketZoom = strconv.FormatBool(row.MarketZoom)
+			commercialize = strconv.FormatBool(row.Commercialize)
+		}
+		zoomPrice, zoomQuantity, zoomActive := "", "", ""
+		if !row.ZoomNotFound {
+			zoomPrice = strconv.FormatFloat(row.ZoomPrice, 'f', 2, 64)
+			zoomQuantity = strconv.Itoa(row.ZoomQuantity)
+			zoomActive = strconv.FormatBool(row.ZoomActive)
+		}
+		writer.Write([]string{
+			row.ID,
+			row.Title,
+			price,
+			zoomPrice,
+			quantity,
+			zoomQuantity,
+			zoomActive,
+			marketZoom,
+			commercialize,
+			row.PublishState,
+			deletedAt,
+			row.Diff,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
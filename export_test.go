@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestWriteCatalogCSV(t *testing.T) {
+	rows := []catalogRow{
+		{ID: "1", Title: "Both", Price: 100, ZoomPrice: 110.5, Quantity: 3, ZoomQuantity: 2, ZoomActive: true, MarketZoom: true, Commercialize: true, PublishState: "publishable", Diff: "Different quantity"},
+		{ID: "2", Title: "Not commercialized", Price: 50, Quantity: 1, MarketZoom: true, PublishState: "unmarked", ZoomNotFound: true},
+		{ID: "3", Title: "Zoom only", ZoomPrice: 20, ZoomQuantity: 4, ZoomActive: true, PublishState: "deleted", Diff: "Not found at Zunka", ZunkaNotFound: true},
+	}
+	buf := bytes.Buffer{}
+	if err := writeCatalogCSV(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "title", "price", "zoom_price", "quantity", "zoom_quantity", "zoom_active", "market_zoom", "commercialize", "publish_state", "deleted_at", "diff"},
+		{"1", "Both", "100.00", "110.50", "3", "2", "true", "true", "true", "publishable", "", "Different quantity"},
+		// Marked to Zoom, not commercialized, Zoom side blank.
+		{"2", "Not commercialized", "50.00", "", "1", "", "", "true", "false", "unmarked", "", ""},
+		// Zunka side blank.
+		{"3", "Zoom only", "", "20.00", "", "4", "true", "", "", "deleted", "", "Not found at Zunka"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records = %d, want %d", len(records), len(want))
+	}
+	for i := range want {
+		if strings.Join(records[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %v, want %v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestWriteCatalogFormat(t *testing.T) {
+	rows := []catalogRow{{ID: "1", MarketZoom: true}, {ID: "2"}}
+	buf := bytes.Buffer{}
+	if err := writeCatalog(&buf, rows, EXPORT_FORMAT_JSONL); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"marketZoom":true`) {
+		t.Errorf("jsonl = %s", buf.String())
+	}
+	if err := writeCatalog(&buf, rows, "xml"); err == nil {
+		t.Errorf("writeCatalog() invalid format, want error")
+	}
+}
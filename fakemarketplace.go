@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Fake marketplace kept in memory, to test marketplaces reconciliation.
+type fakeMarketplace struct {
+	products map[string]marketplaceProduct
+	receipts map[string]marketplaceReceipt
+	tickets  int
+	mux      sync.Mutex
+}
+
+func newFakeMarketplace() *fakeMarketplace {
+	return &fakeMarketplace{
+		products: map[string]marketplaceProduct{},
+		receipts: map[string]marketplaceReceipt{},
+	}
+}
+
+func (f *fakeMarketplace) name() string {
+	return "fake"
+}
+
+func (f *fakeMarketplace) flag() string {
+	return "marketFake"
+}
+
+// Zunka price and quantity, without marketplace charge.
+func (f *fakeMarketplace) convert(prodZunka *productZunka, marked bool) marketplaceProduct {
+	quantity := publishedQuantity(prodZunka)
+	p := marketplaceProduct{
+		ID:           prodZunka.ObjectID.Hex(),
+		Name:         prodZunka.Name,
+		Price:        prodZunka.Price,
+		Quantity:     quantity,
+		PublishState: getMarketPublishState(prodZunka, marked, quantity),
+	}
+	if p.PublishState != PUBLISH_STATE_PUBLISHABLE {
+		p.Quantity = 0
+	}
+	return p
+}
+
+func (f *fakeMarketplace) listProducts(ctx context.Context) ([]marketplaceProduct, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	products := []marketplaceProduct{}
+	for _, p := range f.products {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	return products, nil
+}
+
+func (f *fakeMarketplace) upsertProducts(ctx context.Context, products []marketplaceProduct) (ticketID string, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	results := []marketplaceResult{}
+	for _, p := range products {
+		p.Active = true
+		p.Payload = nil
+		f.products[p.ID] = p
+		results = append(results, marketplaceResult{ProductID: p.ID, Status: 200, Message: "Product updated"})
+	}
+	return f.newTicket(results), nil
+}
+
+// Products are kept as not active, like Zoom.
+func (f *fakeMarketplace) deleteProducts(ctx context.Context, productsID []string) (ticketID string, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	results := []marketplaceResult{}
+	for _, id := range productsID {
+		p, ok := f.products[id]
+		if !ok {
+			results = append(results, marketplaceResult{ProductID: id, Status: 404, Message: "Product not found"})
+			continue
+		}
+		p.Active = false
+		f.products[id] = p
+		results = append(results, marketplaceResult{ProductID: id, Status: 200, Message: "Product removed"})
+	}
+	return f.newTicket(results), nil
+}
+
+func (f *fakeMarketplace) receipt(ctx context.Context, ticketID string) (marketplaceReceipt, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	receipt, ok := f.receipts[ticketID]
+	if !ok {
+		return receipt, errors.New("Ticket not found")
+	}
+	return receipt, nil
+}
+
+// New finished ticket, must be called with lock.
+func (f *fakeMarketplace) newTicket(results []marketplaceResult) string {
+	f.tickets++
+	ticketID := fmt.Sprintf("fake-%d", f.tickets)
+	f.receipts[ticketID] = marketplaceReceipt{Finished: true, Results: results}
+	return ticketID
+}
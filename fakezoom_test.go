@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Fake Zoom webservice, to test without Zoom.
+type fakeZoom struct {
+	products map[string]map[string]interface{}
+	receipts map[string]interface{}
+	orders   []json.RawMessage
+	tickets  int
+	webhook  string // Orders created are sent to webhook.
+	mux      sync.Mutex
+}
+
+// Fake Zoom result for product.
+type fakeZoomResult struct {
+	ProductID string `json:"product_id"`
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+}
+
+func newFakeZoom(webhook string) *fakeZoom {
+	return &fakeZoom{
+		products: map[string]map[string]interface{}{},
+		receipts: map[string]interface{}{},
+		orders:   []json.RawMessage{},
+		webhook:  webhook,
+	}
+}
+
+// Fake Zoom routes.
+func (fz *fakeZoom) router() *httprouter.Router {
+	router := httprouter.New()
+	router.GET("/products", fz.listProducts)
+	router.POST("/products", fz.upsertProducts)
+	router.DELETE("/products", fz.removeProducts)
+	router.GET("/receipt/:ticket", fz.receipt)
+	router.GET("/orders", fz.listOrders)
+	router.PUT("/orders/:id/status", fz.orderStatus)
+	// Not at Zoom, to create orders.
+	router.POST("/orders", fz.createOrder)
+	return router
+}
+
+// List products.
+func (fz *fakeZoom) listProducts(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	fz.mux.Lock()
+	defer fz.mux.Unlock()
+	products := []map[string]interface{}{}
+	for _, product := range fz.products {
+		products = append(products, product)
+	}
+	sort.Slice(products, func(i, j int) bool { return fmt.Sprint(products[i]["id"]) < fmt.Sprint(products[j]["id"]) })
+	fakeZoomJSON(w, map[string]interface{}{
+		"pagination": map[string]int{
+			"current_page":      1,
+			"products_per_page": len(products),
+			"total_products":    len(products),
+		},
+		"products": products,
+	})
+}
+
+// Create or update products.
+func (fz *fakeZoom) upsertProducts(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	body := struct {
+		Products []map[string]interface{} `json:"products"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fz.mux.Lock()
+	defer fz.mux.Unlock()
+	results := []fakeZoomResult{}
+	for _, product := range body.Products {
+		id := fmt.Sprint(product["id"])
+		product["active"] = true
+		fz.products[id] = product
+		results = append(results, fakeZoomResult{ProductID: id, Status: 200, Message: "Product updated"})
+	}
+	fakeZoomJSON(w, map[string]string{"ticket": fz.newTicket(results)})
+}
+
+// Remove products, Zoom keep removed products as not active.
+func (fz *fakeZoom) removeProducts(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	body := struct {
+		Products []struct {
+			ID string `json:"id"`
+		} `json:"products"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fz.mux.Lock()
+	defer fz.mux.Unlock()
+	results := []fakeZoomResult{}
+	for _, product := range body.Products {
+		if p, ok := fz.products[product.ID]; ok {
+			p["active"] = false
+			results = append(results, fakeZoomResult{ProductID: product.ID, Status: 200, Message: "Product removed"})
+		} else {
+			results = append(results, fakeZoomResult{ProductID: product.ID, Status: 404, Message: "Product not found"})
+		}
+	}
+	fakeZoomJSON(w, map[string]string{"ticket": fz.newTicket(results)})
+}
+
+// New finished ticket, must be called with lock.
+func (fz *fakeZoom) newTicket(results []fakeZoomResult) string {
+	fz.tickets++
+	ticketID := fmt.Sprintf("fake-%d", fz.tickets)
+	fz.receipts[ticketID] = map[string]interface{}{
+		"finished":         true,
+		"quantity":         len(results),
+		"requestTimestamp": time.Now().Format("2006-01-02T15:04:05"),
+		"results":          results,
+	}
+	return ticketID
+}
+
+// Ticket receipt.
+func (fz *fakeZoom) receipt(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	fz.mux.Lock()
+	defer fz.mux.Unlock()
+	receipt, ok := fz.receipts[ps.ByName("ticket")]
+	if !ok {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+	fakeZoomJSON(w, receipt)
+}
+
+// List orders created after since.
+func (fz *fakeZoom) listOrders(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	since := zoomTime{}
+	if s := req.URL.Query().Get("since"); s != "" {
+		if err := since.UnmarshalJSON([]byte(s)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	fz.mux.Lock()
+	defer fz.mux.Unlock()
+	orders := []json.RawMessage{}
+	for _, payload := range fz.orders {
+		o := zoomOrderR{}
+		if checkError(json.Unmarshal(payload, &o)) {
+			continue
+		}
+		if !o.CreatedAt.Before(since.Time) {
+			orders = append(orders, payload)
+		}
+	}
+	fakeZoomJSON(w, map[string]interface{}{"orders": orders})
+}
+
+// Create order, sent to webhook if defined.
+func (fz *fakeZoom) createOrder(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	o := zoomOrderR{}
+	if err = json.Unmarshal(payload, &o); err != nil || o.ID == "" {
+		http.Error(w, "Invalid order", http.StatusBadRequest)
+		return
+	}
+	fz.mux.Lock()
+	fz.orders = append(fz.orders, payload)
+	fz.mux.Unlock()
+
+	if fz.webhook != "" {
+		webhookReq, err := http.NewRequest("POST", fz.webhook, bytes.NewBuffer(payload))
+		if err != nil {
+			HandleError(w, err)
+			return
+		}
+		webhookReq.Header.Set("Content-Type", "application/json")
+		webhookReq.SetBasicAuth(zoomUser(), zoomPass())
+		res, err := http.DefaultClient.Do(webhookReq)
+		if err != nil {
+			HandleError(w, err)
+			return
+		}
+		res.Body.Close()
+		log.Printf("Order %s sent to webhook, status: %d", o.ID, res.StatusCode)
+	}
+	w.WriteHeader(201)
+	w.Write([]byte("Created\n"))
+}
+
+// Update order status.
+func (fz *fakeZoom) orderStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	status := zoomOrderStatus{}
+	if err := json.NewDecoder(req.Body).Decode(&status); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Order %s status %s", ps.ByName("id"), status.Status)
+	fz.mux.Lock()
+	defer fz.mux.Unlock()
+	results := []fakeZoomResult{{ProductID: ps.ByName("id"), Status: 200, Message: "Order status updated"}}
+	fakeZoomJSON(w, map[string]string{"ticket": fz.newTicket(results)})
+}
+
+// Write json response.
+func fakeZoomJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	checkError(json.NewEncoder(w).Encode(v))
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const FEED_CACHE_MIN = 10
+
+// Feed formats.
+const (
+	FEED_FORMAT_GOOGLE = "google"
+	FEED_FORMAT_ZOOM   = "zoom"
+	FEED_FORMAT_CSV    = "csv"
+)
+
+// Generated feed.
+type feed struct {
+	Body        []byte
+	ContentType string
+	ETag        string
+	GeneratedAt time.Time
+}
+
+// Feeds cache by format.
+var feedsCache = map[string]*feed{}
+var muxFeedsCache sync.Mutex
+
+// One feed generation by format, not blocking other formats.
+var muxFeedsGenerate = map[string]*sync.Mutex{
+	FEED_FORMAT_GOOGLE: {},
+	FEED_FORMAT_ZOOM:   {},
+	FEED_FORMAT_CSV:    {},
+}
+
+// Google Merchant feed, rss 2.0.
+type googleFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	NS      string   `xml:"xmlns:g,attr"`
+	Channel struct {
+		Title       string           `xml:"title"`
+		Link        string           `xml:"link"`
+		Description string           `xml:"description"`
+		Items       []googleFeedItem `xml:"item"`
+	} `xml:"channel"`
+}
+type googleFeedItem struct {
+	ID                   string   `xml:"g:id"`
+	Title                string   `xml:"g:title"`
+	Description          string   `xml:"g:description"`
+	Link                 string   `xml:"g:link"`
+	ImageLink            string   `xml:"g:image_link,omitempty"`
+	AdditionalImageLinks []string `xml:"g:additional_image_link"`
+	Availability         string   `xml:"g:availability"`
+	Price                string   `xml:"g:price"`
+	GTIN                 string   `xml:"g:gtin,omitempty"`
+	IdentifierExists     string   `xml:"g:identifier_exists,omitempty"`
+	Condition            string   `xml:"g:condition"`
+	ProductType          string   `xml:"g:product_type"`
+	ShippingWeight       string   `xml:"g:shipping_weight,omitempty"`
+}
+
+// Zoom xml feed.
+type zoomFeed struct {
+	XMLName  xml.Name          `xml:"PRODUTOS"`
+	Products []zoomFeedProduct `xml:"PRODUTO"`
+}
+type zoomFeedProduct struct {
+	Code             string `xml:"CODIGO"`
+	Name             string `xml:"NOME"`
+	Department       string `xml:"DEPARTAMENTO"`
+	SubDepartment    string `xml:"SUBDEPARTAMENTO"`
+	Price            string `xml:"PRECO"`
+	Installments     int    `xml:"NPARCELA"`
+	InstallmentPrice string `xml:"VPARCELA"`
+	URL              string `xml:"URL"`
+	ImageURL         string `xml:"URL_IMAGEM"`
+	EAN              string `xml:"EAN,omitempty"`
+	Availability     string `xml:"DISPONIBILIDADE"`
+	FreeShipping     string `xml:"FRETE_GRATIS"`
+	CrossDocking     int    `xml:"PRAZO_ENVIO"`
+}
+
+// Check feed format.
+func validFeedFormat(format string) bool {
+	return format == FEED_FORMAT_GOOGLE || format == FEED_FORMAT_ZOOM || format == FEED_FORMAT_CSV
+}
+
+// Feed format from feed name, extension is optional but must match format.
+func feedFormatFromName(name string) (string, bool) {
+	for _, format := range []string{FEED_FORMAT_GOOGLE, FEED_FORMAT_ZOOM, FEED_FORMAT_CSV} {
+		if name == format || name == format+feedExtension(format) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// Feed file extension.
+func feedExtension(format string) string {
+	if format == FEED_FORMAT_CSV {
+		return ".csv"
+	}
+	return ".xml"
+}
+
+// Get feed from cache or generate it.
+func getFeed(ctx context.Context, format string) (*feed, error) {
+	if !validFeedFormat(format) {
+		return nil, fmt.Errorf("Invalid feed format %s, must be %s, %s or %s", format, FEED_FORMAT_GOOGLE, FEED_FORMAT_ZOOM, FEED_FORMAT_CSV)
+	}
+	if f := cachedFeed(format); f != nil {
+		return f, nil
+	}
+	muxFeedsGenerate[format].Lock()
+	defer muxFeedsGenerate[format].Unlock()
+	// Generated while waiting.
+	if f := cachedFeed(format); f != nil {
+		return f, nil
+	}
+	f, err := generateFeed(ctx, format)
+	if err != nil {
+		return nil, err
+	}
+	muxFeedsCache.Lock()
+	feedsCache[format] = f
+	muxFeedsCache.Unlock()
+	return f, nil
+}
+
+// Cached feed, nil if not cached or expired.
+func cachedFeed(format string) *feed {
+	muxFeedsCache.Lock()
+	defer muxFeedsCache.Unlock()
+	if f, ok := feedsCache[format]; ok && time.Since(f.GeneratedAt) < FEED_CACHE_MIN*time.Minute {
+		return f
+	}
+	return nil
+}
+
+// Generate feed from products published to Zoom.
+func generateFeed(ctx context.Context, format string) (*feed, error) {
+	c := make(chan productZoomAOk)
+	go getAllZunkaProducts(ctx, c)
+	result := <-c
+	if !result.Ok {
+		return nil, errors.New("Could not get Zunka products.")
+	}
+	products := []productZoom{}
+	for _, p := range *result.Products {
+		if p.PublishState.upsert() {
+			products = append(products, p)
+		}
+	}
+
+	f := &feed{GeneratedAt: time.Now()}
+	var err error
+	switch format {
+	case FEED_FORMAT_GOOGLE:
+		f.ContentType = "application/xml; charset=utf-8"
+		f.Body, err = googleFeedXML(products)
+	case FEED_FORMAT_ZOOM:
+		f.ContentType = "application/xml; charset=utf-8"
+		f.Body, err = zoomFeedXML(products)
+	case FEED_FORMAT_CSV:
+		f.ContentType = "text/csv; charset=utf-8"
+		f.Body, err = feedCSV(products)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(f.Body)
+	f.ETag = `"` + hex.EncodeToString(sum[:]) + `"`
+	log.Printf(":: Feed %s generated, products: %d", format, len(products))
+	return f, nil
+}
+
+// Google Merchant xml.
+func googleFeedXML(products []productZoom) ([]byte, error) {
+	g := googleFeed{Version: "2.0", NS: "http://base.google.com/ns/1.0"}
+	g.Channel.Title = "Zunka"
+	g.Channel.Link = "https://www.zunka.com.br"
+	g.Channel.Description = "Produtos Zunka"
+	g.Channel.Items = []googleFeedItem{}
+	for _, p := range products {
+		item := googleFeedItem{
+			ID:                   p.ID,
+			Title:                p.Name,
+			Description:          p.Description,
+			Link:                 p.Url,
+			AdditionalImageLinks: []string{},
+			Availability:         "out of stock",
+			Price:                fmt.Sprintf("%.2f BRL", p.ZunkaPrice),
+			GTIN:                 p.EAN,
+			Condition:            "new",
+			ProductType:          p.Department + " > " + p.SubDepartment,
+		}
+		if p.Availability {
+			item.Availability = "in stock"
+		}
+		if p.EAN == "" {
+			item.IdentifierExists = "no"
+		}
+		if p.Dimensions.Weight != "" && p.Dimensions.Weight != "0" {
+			item.ShippingWeight = p.Dimensions.Weight + " kg"
+		}
+		for i, image := range p.UrlImages {
+			if i == 0 {
+				item.ImageLink = image.Url
+				continue
+			}
+			item.AdditionalImageLinks = append(item.AdditionalImageLinks, image.Url)
+		}
+		g.Channel.Items = append(g.Channel.Items, item)
+	}
+	return feedXML(g)
+}
+
+// Zoom xml, same price sent to Zoom webservice.
+func zoomFeedXML(products []productZoom) ([]byte, error) {
+	z := zoomFeed{Products: []zoomFeedProduct{}}
+	for _, p := range products {
+		product := zoomFeedProduct{
+			Code:             p.ID,
+			Name:             p.Name,
+			Department:       p.Department,
+			SubDepartment:    p.SubDepartment,
+			Price:            feedPrice(p.Price),
+			Installments:     p.Installments.AmountMonths,
+			InstallmentPrice: feedPrice(p.Installments.Price),
+			URL:              p.Url,
+			EAN:              p.EAN,
+			Availability:     "Não",
+			FreeShipping:     "Não",
+			CrossDocking:     p.Dimensions.CrossDocking,
+		}
+		if len(p.UrlImages) > 0 {
+			product.ImageURL = p.UrlImages[0].Url
+		}
+		if p.Availability {
+			product.Availability = "Sim"
+		}
+		if p.FreeShipping {
+			product.FreeShipping = "Sim"
+		}
+		z.Products = append(z.Products, product)
+	}
+	return feedXML(z)
+}
+
+// Generic csv.
+func feedCSV(products []productZoom) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	writer.Write([]string{"id", "title", "description", "category", "ean", "price", "zoom_price", "quantity", "available", "free_shipping", "url", "image_url"})
+	for _, p := range products {
+		imageURL := ""
+		if len(p.UrlImages) > 0 {
+			imageURL = p.UrlImages[0].Url
+		}
+		writer.Write([]string{
+			p.ID,
+			p.Name,
+			p.Description,
+			p.SubDepartment,
+			p.EAN,
+			strconv.FormatFloat(p.ZunkaPrice, 'f', 2, 64),
+			strconv.FormatFloat(p.Price, 'f', 2, 64),
+			strconv.Itoa(p.Quantity),
+			strconv.FormatBool(p.Availability),
+			strconv.FormatBool(p.FreeShipping),
+			p.Url,
+			imageURL,
+		})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// Xml with header.
+func feedXML(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// Price with comma as decimal separator.
+func feedPrice(price float64) string {
+	return strings.Replace(strconv.FormatFloat(price, 'f', 2, 64), ".", ",", 1)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Products to feed, with and without ean and images.
+func feedTestProducts() []productZoom {
+	p1 := productZoom{ID: "1", Name: "Notebook", Description: "Notebook 15", Department: "Informática", SubDepartment: "Notebooks", EAN: "7891234567895", Price: 1100.5, ZunkaPrice: 1000, Quantity: 2, Availability: true, FreeShipping: true, Url: "https://www.zunka.com.br/product/1"}
+	p1.Installments.AmountMonths = 10
+	p1.Installments.Price = 110.05
+	p1.Dimensions.CrossDocking = 2
+	p1.Dimensions.Weight = "2.5"
+	p1.UrlImages = []urlImageZoom{{Url: "https://img/1a.webp"}, {Url: "https://img/1b.webp"}}
+	p2 := productZoom{ID: "2", Name: "Mouse", SubDepartment: "Mouses", Price: 55, ZunkaPrice: 50}
+	return []productZoom{p1, p2}
+}
+
+func TestGoogleFeedXML(t *testing.T) {
+	body, err := googleFeedXML(feedTestProducts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(body, []byte(xml.Header)) {
+		t.Errorf("no xml header")
+	}
+	s := string(body)
+	for _, want := range []string{
+		`<rss version="2.0" xmlns:g="http://base.google.com/ns/1.0">`,
+		"<g:price>1000.00 BRL</g:price>",
+		"<g:availability>in stock</g:availability>",
+		"<g:image_link>https://img/1a.webp</g:image_link>",
+		"<g:additional_image_link>https://img/1b.webp</g:additional_image_link>",
+		"<g:gtin>7891234567895</g:gtin>",
+		"<g:shipping_weight>2.5 kg</g:shipping_weight>",
+		"<g:product_type>Informática &gt; Notebooks</g:product_type>",
+		// Product without ean and stock.
+		"<g:identifier_exists>no</g:identifier_exists>",
+		"<g:availability>out of stock</g:availability>",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("google feed without %s", want)
+		}
+	}
+	if strings.Count(s, "<g:gtin>") != 1 || strings.Count(s, "<g:image_link>") != 1 {
+		t.Errorf("empty gtin or image link not omitted:\n%s", s)
+	}
+}
+
+func TestZoomFeedXML(t *testing.T) {
+	body, err := zoomFeedXML(feedTestProducts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := zoomFeed{}
+	if err = xml.Unmarshal(body, &z); err != nil {
+		t.Fatal(err)
+	}
+	if len(z.Products) != 2 {
+		t.Fatalf("products = %d, want 2", len(z.Products))
+	}
+	want := zoomFeedProduct{
+		Code:             "1",
+		Name:             "Notebook",
+		Department:       "Informática",
+		SubDepartment:    "Notebooks",
+		Price:            "1100,50",
+		Installments:     10,
+		InstallmentPrice: "110,05",
+		URL:              "https://www.zunka.com.br/product/1",
+		ImageURL:         "https://img/1a.webp",
+		EAN:              "7891234567895",
+		Availability:     "Sim",
+		FreeShipping:     "Sim",
+		CrossDocking:     2,
+	}
+	if z.Products[0] != want {
+		t.Errorf("product = %+v, want %+v", z.Products[0], want)
+	}
+	if p := z.Products[1]; p.Availability != "Não" || p.FreeShipping != "Não" || p.ImageURL != "" || p.Price != "55,00" {
+		t.Errorf("product = %+v", p)
+	}
+}
+
+func TestFeedCSV(t *testing.T) {
+	body, err := feedCSV(feedTestProducts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "title", "description", "category", "ean", "price", "zoom_price", "quantity", "available", "free_shipping", "url", "image_url"},
+		{"1", "Notebook", "Notebook 15", "Notebooks", "7891234567895", "1000.00", "1100.50", "2", "true", "true", "https://www.zunka.com.br/product/1", "https://img/1a.webp"},
+		{"2", "Mouse", "", "Mouses", "", "50.00", "55.00", "0", "false", "false", "", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records = %d, want %d", len(records), len(want))
+	}
+	for i := range want {
+		if strings.Join(records[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %v, want %v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestFeedFormatFromName(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantFormat string
+		wantOk     bool
+	}{
+		{"google", FEED_FORMAT_GOOGLE, true},
+		{"google.xml", FEED_FORMAT_GOOGLE, true},
+		{"zoom.xml", FEED_FORMAT_ZOOM, true},
+		{"csv", FEED_FORMAT_CSV, true},
+		{"csv.csv", FEED_FORMAT_CSV, true},
+		{"zoom.csv", "", false},
+		{"csv.xml", "", false},
+		{"google.xml.csv", "", false},
+		{"other.xml", "", false},
+	}
+	for _, tt := range tests {
+		format, ok := feedFormatFromName(tt.name)
+		if format != tt.wantFormat || ok != tt.wantOk {
+			t.Errorf("feedFormatFromName(%q) = %q, %v, want %q, %v", tt.name, format, ok, tt.wantFormat, tt.wantOk)
+		}
+	}
+}
+
+// Feed server with cached feeds, restored at test end.
+func setFeedTest(t *testing.T, feeds map[string]*feed) *httptest.Server {
+	muxFeedsCache.Lock()
+	oldFeeds := feedsCache
+	feedsCache = feeds
+	muxFeedsCache.Unlock()
+	router := httprouter.New()
+	router.GET("/feed/:format", feedHandler)
+	ts := httptest.NewServer(router)
+	t.Cleanup(func() {
+		muxFeedsCache.Lock()
+		feedsCache = oldFeeds
+		muxFeedsCache.Unlock()
+		ts.Close()
+	})
+	return ts
+}
+
+func TestFeedHandler(t *testing.T) {
+	zoom := &feed{Body: []byte("<PRODUTOS/>"), ContentType: "application/xml; charset=utf-8", ETag: `"z1"`, GeneratedAt: time.Now()}
+	ts := setFeedTest(t, map[string]*feed{FEED_FORMAT_ZOOM: zoom})
+	tests := []struct {
+		name        string
+		path        string
+		ifNoneMatch string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"feed", "/feed/zoom.xml", "", 200, "<PRODUTOS/>"},
+		{"without extension", "/feed/zoom", "", 200, "<PRODUTOS/>"},
+		{"changed", "/feed/zoom.xml", `"z0"`, 200, "<PRODUTOS/>"},
+		{"not modified", "/feed/zoom.xml", `"z1"`, 304, ""},
+		{"extension not matching format", "/feed/zoom.csv", "", 404, "Invalid format\n"},
+		{"invalid format", "/feed/other", "", 404, "Invalid format\n"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", ts.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := bytes.Buffer{}
+		body.ReadFrom(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.wantStatus || body.String() != tt.wantBody {
+			t.Errorf("%s: status = %d, body = %q, want %d, %q", tt.name, res.StatusCode, body.String(), tt.wantStatus, tt.wantBody)
+		}
+		if tt.wantStatus == 200 && (res.Header.Get("ETag") != zoom.ETag || res.Header.Get("Content-Type") != zoom.ContentType) {
+			t.Errorf("%s: headers = %v", tt.name, res.Header)
+		}
+	}
+}
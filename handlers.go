@@ -1,8 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -26,3 +31,289 @@ func indexHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params)
 	w.WriteHeader(200)
 	w.Write([]byte("Hello!\n"))
 }
+
+// Products with broken images handler.
+func brokenImagesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(getBrokenImages())
+	HandleError(w, err)
+}
+
+// Product sync history handler.
+func syncHistoryHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	history, err := getSyncHistory(ps.ByName("id"))
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(history)
+	HandleError(w, err)
+}
+
+// Jobs status handler.
+func jobsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(currentScheduler().status())
+	HandleError(w, err)
+}
+
+// Leader status handler.
+func leaderHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	lease, err := getLeaderLease()
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(leaderStatus{
+		InstanceID: instanceID,
+		Leader:     isLeader(),
+		Lease:      lease,
+	})
+	HandleError(w, err)
+}
+
+// Run job now handler.
+func jobRunHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	jobActionResponse(w, currentScheduler().trigger(ps.ByName("name")))
+}
+
+// Pause job handler.
+func jobPauseHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	jobActionResponse(w, currentScheduler().pause(ps.ByName("name")))
+}
+
+// Resume job handler.
+func jobResumeHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	jobActionResponse(w, currentScheduler().resume(ps.ByName("name")))
+}
+
+// Job action response.
+func jobActionResponse(w http.ResponseWriter, err error) {
+	switch err {
+	case nil:
+		w.WriteHeader(200)
+		w.Write([]byte("OK\n"))
+	case errJobNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errJobRunning:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		HandleError(w, err)
+	}
+}
+
+// Catalog export handler.
+func exportHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = EXPORT_FORMAT_CSV
+	}
+	contentType := "text/csv; charset=utf-8"
+	if format == EXPORT_FORMAT_JSONL {
+		contentType = "application/x-ndjson"
+	} else if format != EXPORT_FORMAT_CSV {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+	rows, err := getCatalog(req.Context())
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=zoom-catalog-%s.%s", time.Now().In(brLocation).Format("2006-01-02"), format))
+	err = writeCatalog(w, rows, format)
+	checkError(err)
+}
+
+// Bulk marketZoom change handler, json body or csv body with products id and options at url query.
+func marketZoomHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	change := marketZoomChange{}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "text/csv") {
+		ids, err := readMarketZoomIDs(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := req.URL.Query()
+		change.IDs = ids
+		change.Category = query.Get("category")
+		change.Enable = query.Get("enable") == "true"
+		change.DryRun = query.Get("dryRun") == "true"
+		change.User = query.Get("user")
+	} else {
+		err := json.NewDecoder(req.Body).Decode(&change)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if change.User == "" {
+		change.User, _, _ = req.BasicAuth()
+	}
+	if _, err := marketZoomFilter(&change); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := changeMarketZoom(req.Context(), &change)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	HandleError(w, err)
+}
+
+// Orders handler.
+func ordersHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	orders, err := getOrders()
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(orders)
+	HandleError(w, err)
+}
+
+// Orders webhook handler, orders already received are ignored.
+func ordersWebhookHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	payloads, err := parseOrdersPayload(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, err = receiveOrders(req.Context(), payloads, ORDER_SOURCE_WEBHOOK)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.WriteHeader(200)
+	w.Write([]byte("OK\n"))
+}
+
+// Zoom notifications handler, notification is saved before processing.
+func zoomNotificationsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	n := zoomNotification{}
+	errParse := json.Unmarshal(body, &n)
+	id, err := notificationsStore.saveNotification(req.Context(), n.Event, body)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	if errParse != nil {
+		notificationsStore.notificationProcessed(id, errParse)
+		http.Error(w, errParse.Error(), http.StatusBadRequest)
+		return
+	}
+	err = processZoomNotification(req.Context(), &n)
+	notificationsStore.notificationProcessed(id, err)
+	if err != nil {
+		log.Printf("[warn] Could not process Zoom notification %s. %v", n.Event, err)
+		// Zoom send it again.
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(200)
+	w.Write([]byte("OK\n"))
+}
+
+// Marketplace reconciliation handler, dryRun=true to only show differences.
+func marketplaceReconcileHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	ms, err := getReconcileMarketplace(ps.ByName("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	dryRun := req.URL.Query().Get("dryRun") == "true"
+	// Tickets are checked by leader reconciliation job.
+	if !dryRun && !isLeader() {
+		http.Error(w, "Not leader, reconcile at leader instance or use dryRun", http.StatusConflict)
+		return
+	}
+	run, err := ms.reconcile(req.Context(), dryRun)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(run)
+	checkError(err)
+}
+
+// Product feed handler, cached feed is not sent again if not changed.
+func feedHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	format, ok := feedFormatFromName(ps.ByName("format"))
+	if !ok {
+		http.Error(w, "Invalid format", http.StatusNotFound)
+		return
+	}
+	f, err := getFeed(req.Context(), format)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("ETag", f.ETag)
+	w.Header().Set("Last-Modified", f.GeneratedAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", FEED_CACHE_MIN*60))
+	if req.Header.Get("If-None-Match") == f.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Write(f.Body)
+}
+
+// Price report handler, products with Zoom price above lowest competitor offer.
+func pricesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	report, err := getPriceReport(req.Context())
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(report)
+	checkError(err)
+}
+
+// Product price history handler.
+func priceHistoryHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	history, err := getPriceHistory(req.Context(), ps.ByName("id"))
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(history)
+	checkError(err)
+}
+
+// Order status handler, status is sent to Zoom by push orders status job.
+func orderStatusHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	change := orderStatusChange{}
+	err := json.NewDecoder(req.Body).Decode(&change)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = setOrderStatus(req.Context(), ps.ByName("id"), &change)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(200)
+	w.Write([]byte("OK\n"))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	SYNC_HISTORY_LIMIT          = 100
+	SYNC_HISTORY_RETENTION_DAYS = 90 // Older history is removed by TTL index.
+)
+
+// Sync history actions.
+const (
+	SYNC_ACTION_PUSH    = "push"    // Product sent to Zoom.
+	SYNC_ACTION_DELETE  = "delete"  // Product removed from Zoom.
+	SYNC_ACTION_RECEIPT = "receipt" // Ticket result for product.
+	SYNC_ACTION_GIVE_UP = "give-up" // Ticket without result before deadline.
+)
+
+// Sync history for one product.
+type syncHistory struct {
+	ProductID    string    `bson:"productID" json:"productID"`
+	Action       string    `bson:"action" json:"action"`
+	PayloadHash  string    `bson:"payloadHash,omitempty" json:"payloadHash,omitempty"`
+	TicketID     string    `bson:"ticketID,omitempty" json:"ticketID,omitempty"`
+	Status       int       `bson:"status,omitempty" json:"status,omitempty"`
+	Message      string    `bson:"message,omitempty" json:"message,omitempty"`
+	WarnMessages []string  `bson:"warnMessages,omitempty" json:"warnMessages,omitempty"`
+	CreatedAt    time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// Hash from payload sent to Zoom.
+func payloadHash(payload interface{}) string {
+	payloadJSON, err := json.Marshal(payload)
+	if checkError(err) {
+		return ""
+	}
+	hash := sha256.Sum256(payloadJSON)
+	return hex.EncodeToString(hash[:])
+}
+
+// Index to get product history and TTL index to remove old history.
+func createSyncHistoryIndexes() {
+	collection := client.Database("zunka").Collection("zoomSyncHistory")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{"productID", 1}, {"createdAt", -1}},
+		},
+		{
+			Keys:    bson.D{{"createdAt", 1}},
+			Options: options.Index().SetExpireAfterSeconds(SYNC_HISTORY_RETENTION_DAYS * 24 * 60 * 60),
+		},
+	})
+	checkError(err)
+}
+
+// Save sync history into db.
+func saveSyncHistory(history []syncHistory) {
+	if len(history) == 0 {
+		return
+	}
+	docs := []interface{}{}
+	for _, h := range history {
+		if h.CreatedAt.IsZero() {
+			h.CreatedAt = time.Now()
+		}
+		docs = append(docs, h)
+	}
+	collection := client.Database("zunka").Collection("zoomSyncHistory")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.InsertMany(ctx, docs)
+	checkError(err)
+}
+
+// Save sync history for products sent to Zoom.
+func saveSyncHistoryPush(products []productZoom, ticketID string) {
+	history := []syncHistory{}
+	for _, product := range products {
+		history = append(history, syncHistory{
+			ProductID:   product.ID,
+			Action:      SYNC_ACTION_PUSH,
+			PayloadHash: payloadHash(product),
+			TicketID:    ticketID,
+		})
+	}
+	saveSyncHistory(history)
+}
+
+// Save sync history for products removed from Zoom.
+func saveSyncHistoryDelete(productsID []string, ticketID string) {
+	history := []syncHistory{}
+	for _, id := range productsID {
+		history = append(history, syncHistory{
+			ProductID: id,
+			Action:    SYNC_ACTION_DELETE,
+			TicketID:  ticketID,
+		})
+	}
+	saveSyncHistory(history)
+}
+
+// Save sync history from ticket receipt.
+func saveSyncHistoryReceipt(ticketID string, receipt *zoomReceipt) {
+	history := []syncHistory{}
+	for _, result := range receipt.Results {
+		history = append(history, syncHistory{
+			ProductID:    result.ProductID,
+			Action:       SYNC_ACTION_RECEIPT,
+			TicketID:     ticketID,
+			Status:       result.Status,
+			Message:      result.Message,
+			WarnMessages: result.WarnMessages,
+		})
+	}
+	saveSyncHistory(history)
+}
+
+// Save sync history for ticket given up.
+func saveSyncHistoryGiveUp(ticket *zoomTicket) {
+	history := []syncHistory{}
+	for _, id := range ticket.ProductsID {
+		history = append(history, syncHistory{
+			ProductID: id,
+			Action:    SYNC_ACTION_GIVE_UP,
+			TicketID:  ticket.ID,
+		})
+	}
+	saveSyncHistory(history)
+}
+
+// Get product sync history, newest first.
+func getSyncHistory(productID string) (history []syncHistory, err error) {
+	history = []syncHistory{}
+	collection := client.Database("zunka").Collection("zoomSyncHistory")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{"createdAt", -1}})
+	findOptions.SetLimit(SYNC_HISTORY_LIMIT)
+	cur, err := collection.Find(ctx, bson.M{"productID": productID}, findOptions)
+	if err != nil {
+		return history, err
+	}
+	defer cur.Close(ctx)
+	err = cur.All(ctx, &history)
+	return history, err
+}
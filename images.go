@@ -0,0 +1,262 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ZOOM_IMAGES_MAX                = 4 // Max images accepted by Zoom for one product.
+	ZUNKA_IMAGE_URL                = "https://www.zunka.com.br/img/"
+	IMAGE_CHECK_CACHE_DURATION_MIN = 60
+	IMAGE_CHECK_ERROR_CACHE_MIN    = 5 // Image that could not be checked.
+	IMAGE_CHECK_WORKERS            = 8 // Concurrent http image checks.
+)
+
+// Image check modes.
+const (
+	IMAGE_CHECK_NONE  = "none"
+	IMAGE_CHECK_LOCAL = "local" // Check image file into zunka site image dir.
+	IMAGE_CHECK_HTTP  = "http"  // HEAD request for image url.
+)
+
+// Image check mode.
+var imageCheckMode string
+
+// Zunka site image dir, used by local image check.
+var imageCheckDir string
+
+// Url used by http image check, can be a stand-in server.
+var imageCheckUrl string
+
+// Image check result.
+type imageCheck struct {
+	Ok        bool
+	ExpiresAt time.Time
+}
+
+// Image check results, by image url.
+var imageChecks = map[string]imageCheck{}
+
+// Products with broken images, product id to broken image files.
+var brokenImages = map[string][]string{}
+
+var muxImageCheck sync.Mutex
+
+// Init image check configuration.
+func initImageCheck() {
+	// ZOOM_IMAGE_CHECK=none|local|http
+	imageCheckMode = os.Getenv("ZOOM_IMAGE_CHECK")
+	if imageCheckMode == "" {
+		imageCheckMode = IMAGE_CHECK_NONE
+	}
+	switch imageCheckMode {
+	case IMAGE_CHECK_NONE, IMAGE_CHECK_LOCAL, IMAGE_CHECK_HTTP:
+	default:
+		panic("ZOOM_IMAGE_CHECK must be none, local or http.")
+	}
+
+	// Image dir relative to zunka site path.
+	imageDir := os.Getenv("ZOOM_IMAGE_DIR")
+	if imageDir == "" {
+		imageDir = path.Join("dist", "img")
+	}
+	imageCheckDir = path.Join(zunkaSitePath, imageDir)
+	if imageCheckMode == IMAGE_CHECK_LOCAL {
+		info, err := os.Stat(imageCheckDir)
+		if err != nil || !info.IsDir() {
+			panic("ZOOM_IMAGE_CHECK is local and image dir " + imageCheckDir + " not found, set ZOOM_IMAGE_DIR.")
+		}
+	}
+
+	// Image url for HEAD requests.
+	imageCheckUrl = os.Getenv("ZOOM_IMAGE_CHECK_URL")
+	if imageCheckUrl == "" {
+		imageCheckUrl = ZUNKA_IMAGE_URL
+	}
+	if !strings.HasSuffix(imageCheckUrl, "/") {
+		imageCheckUrl = imageCheckUrl + "/"
+	}
+}
+
+// Product images, main image first.
+func productImages(prodZunka *productZunka) []string {
+	images := []string{}
+	if prodZunka.MainImage != "" {
+		images = append(images, prodZunka.MainImage)
+	}
+	for _, image := range prodZunka.Images {
+		if image != "" && image != prodZunka.MainImage {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// Convert Zunka images to Zoom images, main image first and only images that exist.
+func convertZunkaImagesToZoom(productID string, prodZunka *productZunka) (urlImages []urlImageZoom, broken []string) {
+	broken = []string{}
+	for _, image := range productImages(prodZunka) {
+		if len(urlImages) == ZOOM_IMAGES_MAX {
+			break
+		}
+		if !imageExist(productID, image) {
+			broken = append(broken, image)
+			continue
+		}
+		main := "false"
+		if len(urlImages) == 0 {
+			main = "true"
+		}
+		urlImages = append(urlImages, urlImageZoom{main, ZUNKA_IMAGE_URL + productID + "/" + image})
+	}
+
+	muxImageCheck.Lock()
+	defer muxImageCheck.Unlock()
+	if len(broken) > 0 {
+		brokenImages[productID] = broken
+	} else {
+		delete(brokenImages, productID)
+	}
+	return urlImages, broken
+}
+
+// Check if image exist.
+func imageExist(productID string, image string) bool {
+	if imageCheckMode == IMAGE_CHECK_NONE {
+		return true
+	}
+
+	// Local file.
+	if imageCheckMode == IMAGE_CHECK_LOCAL {
+		_, err := os.Stat(path.Join(imageCheckDir, productID, image))
+		return err == nil
+	}
+
+	// Http, cached result.
+	url := imageCheckUrl + productID + "/" + image
+	if check, ok := cachedImageCheck(url); ok {
+		return check.Ok
+	}
+	return checkImageURL(url)
+}
+
+// Image check not expired.
+func cachedImageCheck(url string) (check imageCheck, ok bool) {
+	muxImageCheck.Lock()
+	defer muxImageCheck.Unlock()
+	check, ok = imageChecks[url]
+	return check, ok && time.Now().Before(check.ExpiresAt)
+}
+
+// Check image by http HEAD, image that could not be checked is considered existing for a short time.
+func checkImageURL(url string) bool {
+	client := &http.Client{Timeout: 5 * time.Second}
+	check := imageCheck{Ok: true, ExpiresAt: time.Now().Add(IMAGE_CHECK_ERROR_CACHE_MIN * time.Minute)}
+	res, err := client.Head(url)
+	if err != nil {
+		log.Printf("[warn] Could not check image %s. %v", url, err)
+	} else {
+		res.Body.Close()
+		check = imageCheck{
+			Ok:        res.StatusCode == http.StatusOK,
+			ExpiresAt: time.Now().Add(IMAGE_CHECK_CACHE_DURATION_MIN * time.Minute),
+		}
+	}
+	muxImageCheck.Lock()
+	imageChecks[url] = check
+	muxImageCheck.Unlock()
+	return check.Ok
+}
+
+// Check products images not cached before conversion, http checks run concurrently.
+func checkProductsImages(prodsZunka []productZunka) {
+	if imageCheckMode != IMAGE_CHECK_HTTP {
+		return
+	}
+	urls := []string{}
+	for i := range prodsZunka {
+		productID := prodsZunka[i].ObjectID.Hex()
+		images := productImages(&prodsZunka[i])
+		// Images sent to Zoom, next ones are checked by conversion only if some of them is broken.
+		if len(images) > ZOOM_IMAGES_MAX {
+			images = images[:ZOOM_IMAGES_MAX]
+		}
+		for _, image := range images {
+			url := imageCheckUrl + productID + "/" + image
+			if _, ok := cachedImageCheck(url); !ok {
+				urls = append(urls, url)
+			}
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
+	c := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < IMAGE_CHECK_WORKERS; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range c {
+				checkImageURL(url)
+			}
+		}()
+	}
+	for _, url := range urls {
+		c <- url
+	}
+	close(c)
+	wg.Wait()
+}
+
+// Get products with broken images.
+func getBrokenImages() map[string][]string {
+	muxImageCheck.Lock()
+	defer muxImageCheck.Unlock()
+	result := map[string][]string{}
+	for id, images := range brokenImages {
+		result[id] = append([]string{}, images...)
+	}
+	return result
+}
+
+// Remove broken images from products no longer at Zunka, skipped products are kept.
+func pruneBrokenImages(products []productZoom, skippedID []string) {
+	productsID := map[string]bool{}
+	for _, product := range products {
+		productsID[product.ID] = true
+	}
+	for _, id := range skippedID {
+		productsID[id] = true
+	}
+	muxImageCheck.Lock()
+	defer muxImageCheck.Unlock()
+	for id := range brokenImages {
+		if !productsID[id] {
+			delete(brokenImages, id)
+		}
+	}
+}
+
+// Log products marked to Zoom market with broken images.
+func logBrokenImages(products []productZoom) {
+	brokenImages := getBrokenImages()
+	brokenImagesList := []string{}
+	for _, product := range products {
+		if _, ok := brokenImages[product.ID]; ok && product.MarketZoom {
+			brokenImagesList = append(brokenImagesList, product.ID)
+		}
+	}
+	if len(brokenImagesList) == 0 {
+		return
+	}
+	sort.Strings(brokenImagesList)
+	log.Printf("\tProducts with broken images (%d): %s", len(brokenImagesList), strings.Join(brokenImagesList, ", "))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Set image check mode, restored at test end.
+func setImageCheck(t *testing.T, mode string, dir string, url string) {
+	oldMode, oldDir, oldUrl := imageCheckMode, imageCheckDir, imageCheckUrl
+	imageCheckMode, imageCheckDir, imageCheckUrl = mode, dir, url
+	muxImageCheck.Lock()
+	imageChecks = map[string]imageCheck{}
+	muxImageCheck.Unlock()
+	t.Cleanup(func() {
+		imageCheckMode, imageCheckDir, imageCheckUrl = oldMode, oldDir, oldUrl
+	})
+}
+
+func TestImageExistLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zoomimages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(path.Join(dir, "p1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path.Join(dir, "p1", "a.webp"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	setImageCheck(t, IMAGE_CHECK_LOCAL, dir, "")
+
+	tests := []struct {
+		productID string
+		image     string
+		want      bool
+	}{
+		{"p1", "a.webp", true},
+		{"p1", "b.webp", false},
+		{"p2", "a.webp", false},
+	}
+	for _, tt := range tests {
+		if got := imageExist(tt.productID, tt.image); got != tt.want {
+			t.Errorf("imageExist(%s, %s) = %v, want %v", tt.productID, tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestImageExistHttp(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/p1/a.webp" {
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	setImageCheck(t, IMAGE_CHECK_HTTP, "", ts.URL+"/")
+
+	for i := 0; i < 2; i++ {
+		if !imageExist("p1", "a.webp") {
+			t.Errorf("imageExist(p1, a.webp) = false, want true")
+		}
+		if imageExist("p1", "b.webp") {
+			t.Errorf("imageExist(p1, b.webp) = true, want false")
+		}
+	}
+	// Second round from cache.
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+}
+
+func TestImageExistHttpErrorCached(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := ts.URL + "/"
+	ts.Close()
+	setImageCheck(t, IMAGE_CHECK_HTTP, "", url)
+
+	// Image that could not be checked is considered existing.
+	if !imageExist("p1", "a.webp") {
+		t.Errorf("imageExist(p1, a.webp) = false, want true")
+	}
+	if _, ok := cachedImageCheck(url + "p1/a.webp"); !ok {
+		t.Errorf("image check error not cached")
+	}
+}
+
+func TestCheckProductsImages(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer ts.Close()
+	setImageCheck(t, IMAGE_CHECK_HTTP, "", ts.URL+"/")
+
+	prodsZunka := []productZunka{}
+	for i := 0; i < 10; i++ {
+		prodsZunka = append(prodsZunka, productZunka{ObjectID: primitive.NewObjectID(), MainImage: "a.webp", Images: []string{"a.webp", "b.webp"}})
+	}
+	// Only images sent to Zoom.
+	prodsZunka = append(prodsZunka, productZunka{ObjectID: primitive.NewObjectID(), Images: []string{"1.webp", "2.webp", "3.webp", "4.webp", "5.webp", "6.webp"}})
+	checkProductsImages(prodsZunka)
+	if requests != 20+ZOOM_IMAGES_MAX {
+		t.Errorf("requests = %d, want %d", requests, 20+ZOOM_IMAGES_MAX)
+	}
+	// Conversion uses only cached checks.
+	for i := range prodsZunka {
+		convertZunkaImagesToZoom(prodsZunka[i].ObjectID.Hex(), &prodsZunka[i])
+	}
+	if requests != 20+ZOOM_IMAGES_MAX {
+		t.Errorf("requests after conversion = %d, want %d", requests, 20+ZOOM_IMAGES_MAX)
+	}
+}
+
+func TestConvertZunkaImagesToZoom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zoomimages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(path.Join(dir, "p1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range []string{"a", "b", "c", "d", "e", "f"} {
+		if err = ioutil.WriteFile(path.Join(dir, "p1", image), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setImageCheck(t, IMAGE_CHECK_LOCAL, dir, "")
+
+	tests := []struct {
+		name       string
+		mainImage  string
+		images     []string
+		wantImages []string
+		wantBroken []string
+	}{
+		{"no images", "", []string{}, []string{}, []string{}},
+		{"main first", "c", []string{"a", "b", "c"}, []string{"c", "a", "b"}, []string{}},
+		{"main not at images", "d", []string{"a"}, []string{"d", "a"}, []string{}},
+		{"max images", "", []string{"a", "b", "c", "d", "e", "f"}, []string{"a", "b", "c", "d"}, []string{}},
+		{"broken skipped", "x", []string{"a", "y", "b"}, []string{"a", "b"}, []string{"x", "y"}},
+		{"empty and duplicated", "a", []string{"", "a", "b"}, []string{"a", "b"}, []string{}},
+	}
+	for _, tt := range tests {
+		prodZunka := productZunka{MainImage: tt.mainImage, Images: tt.images}
+		urlImages, broken := convertZunkaImagesToZoom("p1", &prodZunka)
+		if len(urlImages) != len(tt.wantImages) {
+			t.Errorf("%s: images = %v, want %v", tt.name, urlImages, tt.wantImages)
+			continue
+		}
+		for i, image := range tt.wantImages {
+			wantMain := "false"
+			if i == 0 {
+				wantMain = "true"
+			}
+			if urlImages[i].Url != ZUNKA_IMAGE_URL+"p1/"+image || urlImages[i].Main != wantMain {
+				t.Errorf("%s: image %d = %v, want %s main %s", tt.name, i, urlImages[i], image, wantMain)
+			}
+		}
+		if len(broken) != len(tt.wantBroken) {
+			t.Errorf("%s: broken = %v, want %v", tt.name, broken, tt.wantBroken)
+			continue
+		}
+		for i := range broken {
+			if broken[i] != tt.wantBroken[i] {
+				t.Errorf("%s: broken = %v, want %v", tt.name, broken, tt.wantBroken)
+			}
+		}
+	}
+}
+
+func TestPruneBrokenImages(t *testing.T) {
+	muxImageCheck.Lock()
+	oldBrokenImages := brokenImages
+	brokenImages = map[string][]string{"p1": {"a.webp"}, "p2": {"b.webp"}, "p3": {"c.webp"}}
+	muxImageCheck.Unlock()
+	defer func() {
+		muxImageCheck.Lock()
+		brokenImages = oldBrokenImages
+		muxImageCheck.Unlock()
+	}()
+
+	// p2 removed from Zunka, p3 could not be decoded.
+	pruneBrokenImages([]productZoom{{ID: "p1"}, {ID: "p4"}}, []string{"p3"})
+	got := getBrokenImages()
+	if len(got) != 2 || got["p1"] == nil || got["p3"] == nil {
+		t.Errorf("broken images = %v, want p1 and p3", got)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	LEADER_LEASE_ID    = "zoomproducts"
+	LEADER_LEASE_S     = 30 // Lease expire if not renewed.
+	LEADER_HEARTBEAT_S = 10 // Renew lease interval.
+)
+
+// Leader lease, only the instance owning the lease run sync jobs.
+type leaderLease struct {
+	ID        string    `bson:"_id" json:"-"`
+	Owner     string    `bson:"owner" json:"owner"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Leader status.
+type leaderStatus struct {
+	InstanceID string       `json:"instanceID"`
+	Leader     bool         `json:"leader"`
+	Lease      *leaderLease `json:"lease"`
+}
+
+// Instance id, used as lease owner.
+var instanceID string
+
+// Leader state.
+var leading bool
+var leaseExpiresAt time.Time
+var stopLeadingCtx context.CancelFunc
+var muxLeader sync.Mutex
+
+// Init instance id.
+func initInstanceID() {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	instanceID = fmt.Sprintf("%s-%d-%04d", hostname, os.Getpid(), rand.New(rand.NewSource(time.Now().UnixNano())).Intn(10000))
+}
+
+// Run leader election until context is canceled, releasing lease at end.
+func runLeaderElection(ctx context.Context) {
+	defer runningJobs.Done()
+	log.Printf("Instance id: %s", instanceID)
+	createLeaderLeaseIndex()
+
+	ticker := time.NewTicker(LEADER_HEARTBEAT_S * time.Second)
+	defer ticker.Stop()
+	for {
+		checkLeaderLease(ctx)
+		select {
+		case <-ctx.Done():
+			if isLeader() {
+				stopLeading()
+				releaseLeaderLease()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Leader change after lease check.
+type leaderChange int
+
+const (
+	LEADER_KEEP leaderChange = iota
+	LEADER_START
+	LEADER_STOP
+)
+
+// Leader change from lease acquired or renewed, leader keep leading while lease not expired if could not renew it.
+func nextLeaderChange(leading bool, acquired bool, err error, expiresAt time.Time, now time.Time) leaderChange {
+	if err != nil {
+		if leading && now.After(expiresAt.Add(-LEADER_HEARTBEAT_S*time.Second)) {
+			return LEADER_STOP
+		}
+		return LEADER_KEEP
+	}
+	if acquired && !leading {
+		return LEADER_START
+	}
+	if !acquired && leading {
+		return LEADER_STOP
+	}
+	return LEADER_KEEP
+}
+
+// Acquire or renew lease, start or stop leading.
+func checkLeaderLease(ctx context.Context) {
+	ok, err := acquireLeaderLease(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Printf("[warn] Could not renew leader lease. %v", err)
+	}
+	muxLeader.Lock()
+	change := nextLeaderChange(leading, ok, err, leaseExpiresAt, time.Now())
+	muxLeader.Unlock()
+	switch change {
+	case LEADER_START:
+		if err = startLeading(ctx); err != nil {
+			// Other instance can lead, or try again at next heartbeat.
+			log.Printf("[error] Could not start leading. %v", err)
+			releaseLeaderLease()
+		}
+	case LEADER_STOP:
+		if err != nil {
+			log.Println("[warn] Leader lease expiring, stop leading")
+		} else {
+			log.Println("[warn] Leader lease lost")
+		}
+		stopLeading()
+	}
+}
+
+// Acquire lease if free or expired, or renew it if owned.
+func acquireLeaderLease(ctx context.Context) (bool, error) {
+	collection := client.Database("zunka").Collection("zoomLeaderLease")
+	ctxUpdate, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	now := time.Now()
+	expiresAt := now.Add(LEADER_LEASE_S * time.Second)
+	filter := bson.M{
+		"_id": LEADER_LEASE_ID,
+		"$or": bson.A{
+			bson.M{"owner": instanceID},
+			bson.M{"expiresAt": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"owner": instanceID, "expiresAt": expiresAt},
+	}
+	_, err := collection.UpdateOne(ctxUpdate, filter, update, options.Update().SetUpsert(true))
+	// Lease owned by other instance, upsert try to insert a existing id.
+	if isDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	muxLeader.Lock()
+	leaseExpiresAt = expiresAt
+	muxLeader.Unlock()
+	return true, nil
+}
+
+// Release lease, so other instance can lead without wait it expire.
+func releaseLeaderLease() {
+	collection := client.Database("zunka").Collection("zoomLeaderLease")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": LEADER_LEASE_ID, "owner": instanceID})
+	if !checkError(err) {
+		log.Println("Leader lease released")
+	}
+}
+
+// Get leader lease.
+func getLeaderLease() (*leaderLease, error) {
+	collection := client.Database("zunka").Collection("zoomLeaderLease")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	lease := leaderLease{}
+	err := collection.FindOne(ctx, bson.M{"_id": LEADER_LEASE_ID}).Decode(&lease)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// TTL index, so lease from dead instance is removed.
+func createLeaderLeaseIndex() {
+	collection := client.Database("zunka").Collection("zoomLeaderLease")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	checkError(err)
+}
+
+// Check if mongo error is a duplicate key error.
+func isDuplicateKeyError(err error) bool {
+	if writeException, ok := err.(mongo.WriteException); ok {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == 11000 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Is leader.
+func isLeader() bool {
+	muxLeader.Lock()
+	defer muxLeader.Unlock()
+	return leading
+}
+
+// Start sync jobs, state is loaded again since other instance may have changed it.
+func startLeading(ctx context.Context) error {
+	muxUpdateZoomProducts.Lock()
+	if err := getNewestProductUpdatedAt(); err != nil {
+		muxUpdateZoomProducts.Unlock()
+		return err
+	}
+	// Tickets sent by previous leader are checked.
+	if err := loadZoomTickets(); err != nil {
+		muxUpdateZoomProducts.Unlock()
+		return err
+	}
+	log.Println("Leading, starting sync jobs")
+	leaderCtx, cancel := context.WithCancel(ctx)
+	pendingProductsWatermark = nil
+	loadReactivations()
+	muxUpdateZoomProducts.Unlock()
+
+	s := newJobScheduler(leaderCtx)
+	// Check consistency at beggin.
+	s.add(JOB_CHECK_CONSISTENCY, time.Minute*TIME_TO_CHECK_CONCISTENCY_MIN, time.Second*JOB_JITTER_S, 0, checkConsistency)
+	s.add(JOB_CHECK_TICKETS, time.Minute*TIME_TO_CHECK_TICKETS_MIN, time.Second*JOB_JITTER_S, time.Minute*TIME_TO_CHECK_TICKETS_MIN_S, checkTickets)
+	if syncMode != SYNC_MODE_CHANGE_STREAM || !startChangeStream(leaderCtx) {
+		s.add(JOB_CHECK_PRODUCTS, time.Minute*TIME_TO_CHECK_PRODUCTS_MIN, time.Second*JOB_JITTER_S, time.Minute*TIME_TO_CHECK_PRODUCTS_MIN_S, checkProducts)
+	}
+	if ordersMode != ORDERS_MODE_NONE {
+		s.add(JOB_CHECK_ORDERS, time.Minute*TIME_TO_CHECK_ORDERS_MIN, time.Second*JOB_JITTER_S, 0, checkOrders)
+		s.add(JOB_PUSH_ORDERS, time.Minute*TIME_TO_PUSH_ORDERS_STATUS_MIN, time.Second*JOB_JITTER_S, time.Minute*TIME_TO_PUSH_ORDERS_STATUS_MIN, pushOrdersStatus)
+	}
+	// Zoom is reconciled by consistency and products jobs.
+	for _, ms := range marketplaces[1:] {
+		s.add(marketplaceJobName(ms), time.Minute*TIME_TO_RECONCILE_MARKETPLACE_MIN, time.Second*JOB_JITTER_S, 0, ms.job)
+	}
+	if config.Pricing.OffersSource != "" {
+		s.add(JOB_CHECK_PRICES, time.Minute*time.Duration(config.Pricing.CheckIntervalMin), time.Second*JOB_JITTER_S, 0, checkPrices)
+	}
+	setScheduler(s)
+
+	muxLeader.Lock()
+	leading = true
+	stopLeadingCtx = cancel
+	muxLeader.Unlock()
+	return nil
+}
+
+// Stop sync jobs, running jobs are canceled.
+func stopLeading() {
+	muxLeader.Lock()
+	leading = false
+	cancel := stopLeadingCtx
+	stopLeadingCtx = nil
+	muxLeader.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	if !waitChangeStream(SHUTDOWN_JOBS_TIMEOUT_S * time.Second) {
+		log.Println("[warn] Change stream not stopped")
+	}
+	s := currentScheduler()
+	setScheduler(newJobScheduler(context.Background()))
+	if s.stop(SHUTDOWN_JOBS_TIMEOUT_S * time.Second) {
+		log.Println("Not leading, sync jobs stopped")
+	} else {
+		log.Println("[warn] Not leading, sync jobs not stopped")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNextLeaderChange(t *testing.T) {
+	now := time.Now()
+	errRenew := errors.New("could not renew")
+	tests := []struct {
+		name      string
+		leading   bool
+		acquired  bool
+		err       error
+		expiresAt time.Time
+		want      leaderChange
+	}{
+		{"acquire", false, true, nil, now.Add(LEADER_LEASE_S * time.Second), LEADER_START},
+		{"renew", true, true, nil, now.Add(LEADER_LEASE_S * time.Second), LEADER_KEEP},
+		{"owned by other", false, false, nil, time.Time{}, LEADER_KEEP},
+		{"lose", true, false, nil, now.Add(LEADER_LEASE_S * time.Second), LEADER_STOP},
+		{"renew error before expire", true, false, errRenew, now.Add(LEADER_LEASE_S * time.Second), LEADER_KEEP},
+		{"renew error expiring", true, false, errRenew, now.Add(LEADER_HEARTBEAT_S * time.Second / 2), LEADER_STOP},
+		{"renew error expired", true, false, errRenew, now.Add(-time.Second), LEADER_STOP},
+		{"acquire error", false, false, errRenew, time.Time{}, LEADER_KEEP},
+	}
+	for _, tt := range tests {
+		if got := nextLeaderChange(tt.leading, tt.acquired, tt.err, tt.expiresAt, now); got != tt.want {
+			t.Errorf("%s: nextLeaderChange() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -25,6 +27,9 @@ var client *mongo.Client
 var err error
 var logPath string
 
+// Zunka site path.
+var zunkaSitePath string
+
 // Production mode.
 var production bool
 
@@ -32,10 +37,10 @@ var production bool
 var initTime time.Time
 
 // Newest updated time product processed.
-var newestProductUpdatedAt time.Time
+var newestProductUpdatedAt productsWatermark
 
-// Newest updated time product processed temp.
-var newestProductUpdatedAtTemp time.Time
+// Newest updated time waiting tickets to finish before be saved.
+var pendingProductsWatermark *productsWatermark
 
 // Newest updated time product processed db param name.
 const LAST_PRODUCT_UPDATED_TIME = "ZOOMPRODUCTS-last-product-updated-time"
@@ -57,7 +62,10 @@ func init() {
 
 	// Listern address.
 	address = ":8082"
+}
 
+// Init server, commands use initCommand.
+func initServer() {
 	// Path for log.
 	zunkaPathdata := os.Getenv("ZUNKAPATH")
 	if zunkaPathdata == "" {
@@ -65,10 +73,13 @@ func init() {
 	}
 	logPath := path.Join(zunkaPathdata, "log", "zoom")
 	// Path for Zunka site.
-	zunkaPathDist := os.Getenv("ZUNKA_SITE_PATH")
-	if zunkaPathDist == "" {
+	zunkaSitePath = os.Getenv("ZUNKA_SITE_PATH")
+	if zunkaSitePath == "" {
 		panic("ZUNKA_SITE_PATH not defined.")
 	}
+	initModes()
+	// Instance id for leader election.
+	initInstanceID()
 	// Create path.
 	os.MkdirAll(logPath, os.ModePerm)
 
@@ -85,6 +96,47 @@ func init() {
 	// log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.SetPrefix("[zoomproducts] ")
 	log.SetFlags(log.Ldate | log.Lmicroseconds | log.Lmsgprefix)
+
+	// Configuration.
+	configFile := os.Getenv("ZOOM_CONFIG")
+	if configFile == "" {
+		configFile = path.Join(zunkaPathdata, "zoom", "zoomproducts.json")
+	}
+	loadConfig(configFile)
+}
+
+// Init command, ZUNKAPATH and ZUNKA_SITE_PATH are optional and log is not written to file.
+func initCommand() {
+	// Command output is written to stdout.
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("[zoomproducts] ")
+	log.SetFlags(log.Ldate | log.Lmicroseconds | log.Lmsgprefix)
+
+	zunkaSitePath = os.Getenv("ZUNKA_SITE_PATH")
+	initModes()
+
+	// Configuration, default if no config file.
+	configFile := os.Getenv("ZOOM_CONFIG")
+	if configFile == "" && os.Getenv("ZUNKAPATH") != "" {
+		configFile = path.Join(os.Getenv("ZUNKAPATH"), "zoom", "zoomproducts.json")
+	}
+	if configFile == "" {
+		config = defaultConfig()
+		return
+	}
+	loadConfig(configFile)
+}
+
+// Init modes from env.
+func initModes() {
+	// Image check.
+	initImageCheck()
+	// Sync mode.
+	initSyncMode()
+	// Orders mode.
+	initOrdersMode()
+	initMarketplaces()
+	initNotifiers()
 }
 
 func checkError(err error) bool {
@@ -99,42 +151,61 @@ func checkError(err error) bool {
 }
 
 func main() {
+	// Command.
+	if isCommand() {
+		initCommand()
+		runCommand(os.Args[1:])
+	}
+	initServer()
+
 	// Log start.
 	runMode := "development"
 	if production {
 		runMode = "production"
 	}
 	log.Printf("Running in %v mode (version %s)\n", runMode, version)
+	log.Printf("Sync mode: %s", syncMode)
 
-	// MongoDB config.
-	client, err = mongo.NewClient(options.Client().ApplyURI(zunkaSiteMongoDBConnectionString))
-
-	// MongoDB client.
-	ctxClient, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	err = client.Connect(ctxClient)
-	if err != nil {
-		log.Fatalf("Error. Could not connect to mongodb. %v\n", err)
-	}
-
-	// Ping mongoDB.
-	ctxPing, _ := context.WithTimeout(context.Background(), 2*time.Second)
-	err = client.Ping(ctxPing, readpref.Primary())
-	if err != nil {
-		log.Fatalf("Error. Could not ping mongodb. %v\n", err)
-	}
+	connectMongo()
+	createSyncHistoryIndexes()
+	createPriceHistoryIndexes()
 
 	// Init router.
 	router := httprouter.New()
 	// router.GET("/productsrv", checkZoomAuthorization(indexHandler))
 	router.GET("/", checkZoomAuthorization(indexHandler))
+	router.GET("/images/broken", checkZunkaSiteAuthorization(brokenImagesHandler))
+	router.GET("/history/:id", checkZunkaSiteAuthorization(syncHistoryHandler))
+	router.GET("/jobs", checkZunkaSiteAuthorization(jobsHandler))
+	router.POST("/jobs/:name/run", checkZunkaSiteAuthorization(jobRunHandler))
+	router.POST("/jobs/:name/pause", checkZunkaSiteAuthorization(jobPauseHandler))
+	router.POST("/jobs/:name/resume", checkZunkaSiteAuthorization(jobResumeHandler))
+	router.GET("/leader", checkZunkaSiteAuthorization(leaderHandler))
+	router.GET("/export", checkZunkaSiteAuthorization(exportHandler))
+	router.POST("/market-zoom", checkZunkaSiteAuthorization(marketZoomHandler))
+	router.GET("/orders", checkZunkaSiteAuthorization(ordersHandler))
+	router.PUT("/orders/:id/status", checkZunkaSiteAuthorization(orderStatusHandler))
+	router.POST("/marketplaces/:name/reconcile", checkZunkaSiteAuthorization(marketplaceReconcileHandler))
+	// Feed only with its own credentials, not with Zunka site credentials.
+	if feedUser, feedPass := os.Getenv("ZOOM_FEED_USER"), os.Getenv("ZOOM_FEED_PASS"); feedUser != "" && feedPass != "" {
+		router.GET("/feed/:format", checkFeedAuthorization(feedUser, feedPass, feedHandler))
+	} else {
+		log.Println("Feed disabled, ZOOM_FEED_USER and ZOOM_FEED_PASS not defined")
+	}
+	router.GET("/prices", checkZunkaSiteAuthorization(pricesHandler))
+	router.GET("/prices/:id", checkZunkaSiteAuthorization(priceHistoryHandler))
+	router.POST("/zoom/notifications", checkZoomAuthorization(zoomNotificationsHandler))
+	if ordersMode == ORDERS_MODE_WEBHOOK {
+		router.POST("/orders/webhook", checkZoomAuthorization(ordersWebhookHandler))
+	}
 
-	getNewestProductUpdatedAt()
-	zoomTickets = map[string]*zoomTicket{}
-	// checkConsistency()
-	// checkConsistencyTimer = time.AfterFunc(time.Minute*TIME_TO_CHECK_CONCISTENCY_MIN_S, checkConsistency)
-	checkTicketsTimer = time.AfterFunc(time.Minute*TIME_TO_CHECK_TICKETS_MIN_S, checkTickets)
-	// checkProductsTimer = time.AfterFunc(time.Minute*TIME_TO_CHECK_PRODUCTS_MIN_S, checkProducts)
+	// Canceled on shutdown, to stop running sync.
+	ctx, cancelCtx := context.WithCancel(context.Background())
+
+	// Jobs run only by leader instance, standby instances just serve the api.
+	setScheduler(newJobScheduler(ctx))
+	runningJobs.Add(1)
+	go runLeaderElection(ctx)
 
 	// Create server.
 	server := &http.Server{
@@ -146,14 +217,11 @@ func main() {
 		IdleTimeout:  15 * time.Second,
 	}
 
-	// Check consistency at beggin.
-	checkConsistency()
-
 	// Gracegull shutdown.
 	serverStopFinish := make(chan bool, 1)
 	serverStopRequest := make(chan os.Signal, 1)
 	signal.Notify(serverStopRequest, os.Interrupt)
-	go shutdown(server, serverStopRequest, serverStopFinish)
+	go shutdown(server, cancelCtx, serverStopRequest, serverStopFinish)
 
 	log.Printf("Listen address: %s", address[1:])
 	// log.Fatal(http.ListenAndServe(address, newLogger(router)))
@@ -164,18 +232,48 @@ func main() {
 	log.Println("Server stopped")
 }
 
-func shutdown(server *http.Server, serverStopRequest <-chan os.Signal, serverStopFinish chan<- bool) {
-	<-serverStopRequest
-	log.Println("Server is shutting down...")
-	// Stop timers.
-	if checkProductsTimer != nil {
-		checkProductsTimer.Stop()
+// Connect to mongoDB.
+func connectMongo() {
+	// MongoDB config.
+	client, err = mongo.NewClient(options.Client().ApplyURI(zunkaSiteMongoDBConnectionString))
+
+	// MongoDB client.
+	ctxClient, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = client.Connect(ctxClient)
+	if err != nil {
+		log.Fatalf("Error. Could not connect to mongodb. %v\n", err)
 	}
-	if checkConsistencyTimer != nil {
-		checkConsistencyTimer.Stop()
+
+	// Ping mongoDB.
+	ctxPing, cancelPing := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelPing()
+	err = client.Ping(ctxPing, readpref.Primary())
+	if err != nil {
+		log.Fatalf("Error. Could not ping mongodb. %v\n", err)
 	}
-	if checkTicketsTimer != nil {
-		checkTicketsTimer.Stop()
+}
+
+func shutdown(server *http.Server, cancelCtx context.CancelFunc, serverStopRequest <-chan os.Signal, serverStopFinish chan<- bool) {
+	<-serverStopRequest
+	log.Println("Server is shutting down...")
+	// Cancel running sync and change stream.
+	cancelCtx()
+	jobsFinished := make(chan bool)
+	go func() {
+		runningJobs.Wait()
+		close(jobsFinished)
+	}()
+	select {
+	case <-jobsFinished:
+		if currentScheduler().stop(SHUTDOWN_JOBS_TIMEOUT_S * time.Second) {
+			log.Println("Running sync stopped")
+		} else {
+			log.Println("[warn] Running jobs not stopped, shutting down anyway")
+		}
+	case <-time.After(SHUTDOWN_JOBS_TIMEOUT_S * time.Second):
+		currentScheduler().stop(0)
+		log.Println("[warn] Running sync not stopped, shutting down anyway")
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -209,6 +307,20 @@ func checkZoomAuthorization(h httprouter.Handle) httprouter.Handle {
 	}
 }
 
+// Feed authorization, with feed own credentials.
+func checkFeedAuthorization(feedUser string, feedPass string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, p httprouter.Params) {
+		user, pass, ok := req.BasicAuth()
+		if ok && user == feedUser && pass == feedPass {
+			h(w, req, p)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="Please enter your username and password for this service"`)
+		w.WriteHeader(401)
+		w.Write([]byte("Unauthorised\n"))
+	}
+}
+
 // Authorization.
 func checkZunkaSiteAuthorization(h httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, req *http.Request, p httprouter.Params) {
@@ -257,47 +369,141 @@ func checkFatalError(err error) {
 	}
 }
 
+/**************************************************************************************************
+* Jobs.
+**************************************************************************************************/
+const SHUTDOWN_JOBS_TIMEOUT_S = 20
+
+// Running jobs not run by scheduler, waited on shutdown.
+var runningJobs sync.WaitGroup
+
+/**************************************************************************************************
+* Retry with backoff.
+**************************************************************************************************/
+const (
+	RETRY_MIN_S   = 15
+	RETRY_MAX_MIN = 30
+)
+
+// Consecutive failures count.
+func nextFailures(failures int, ok bool) int {
+	if ok {
+		return 0
+	}
+	return failures + 1
+}
+
+// Delay to next run, interval if no failures, else exponential backoff.
+func retryDelay(interval time.Duration, failures int) time.Duration {
+	if failures == 0 {
+		return interval
+	}
+	delay := RETRY_MIN_S * time.Second
+	for i := 1; i < failures && delay < RETRY_MAX_MIN*time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > RETRY_MAX_MIN*time.Minute {
+		delay = RETRY_MAX_MIN * time.Minute
+	}
+	log.Printf("[warn] Failed %d time(s), retrying in %v", failures, delay)
+	return delay
+}
+
 /**************************************************************************************************
 * Last time products was retrived from db.
 **************************************************************************************************/
+// Newest updated time product synced, with products synced at same updated time.
+type productsWatermark struct {
+	UpdatedAt  time.Time `bson:"value"`
+	ProductsID []string  `bson:"productsID"`
+	SkippedID  []string  `bson:"skippedID"` // Products not decoded, checked again until synced.
+	TicketsID  []string  `bson:"-"`         // Tickets to finish before save it.
+}
+
+// New watermark from synced products, skippedID are products not decoded.
+func newProductsWatermark(watermark productsWatermark, products []productZoom, skippedID []string) productsWatermark {
+	newWatermark := productsWatermark{
+		UpdatedAt:  watermark.UpdatedAt,
+		ProductsID: append([]string{}, watermark.ProductsID...),
+		SkippedID:  append([]string{}, skippedID...),
+	}
+	for _, product := range products {
+		if product.UpdatedAt.After(newWatermark.UpdatedAt) {
+			newWatermark.UpdatedAt = product.UpdatedAt
+			newWatermark.ProductsID = []string{}
+		}
+		if product.UpdatedAt.Equal(newWatermark.UpdatedAt) {
+			newWatermark.ProductsID = append(newWatermark.ProductsID, product.ID)
+		}
+	}
+	return newWatermark
+}
+
+// Save pending watermark when all its tickets finish successfully, discard it if some ticket fail.
+func productsWatermarkTicketFinished(ticketID string, ok bool) {
+	if pendingProductsWatermark == nil {
+		return
+	}
+	ticketsID := []string{}
+	for _, id := range pendingProductsWatermark.TicketsID {
+		if id != ticketID {
+			ticketsID = append(ticketsID, id)
+		}
+	}
+	// Not from pending watermark.
+	if len(ticketsID) == len(pendingProductsWatermark.TicketsID) {
+		return
+	}
+	if !ok {
+		log.Printf("\tTicket %v not successful, changed products will be synced again.", ticketID)
+		pendingProductsWatermark = nil
+		return
+	}
+	pendingProductsWatermark.TicketsID = ticketsID
+	if len(ticketsID) == 0 {
+		// Changed products are synced again if it could not be saved.
+		checkError(updateNewestProductUpdatedAt(*pendingProductsWatermark))
+		pendingProductsWatermark = nil
+	}
+}
+
 // Get newest product updated at from db.
-func getNewestProductUpdatedAt() {
+func getNewestProductUpdatedAt() error {
 	collection := client.Database("zunka").Collection("params")
 
-	ctxFind, _ := context.WithTimeout(context.Background(), 3*time.Second)
+	ctxFind, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 	filter := bson.D{
 		{"name", LAST_PRODUCT_UPDATED_TIME},
 	}
-	var result struct {
-		Value time.Time `bson:"value"`
-	}
-	// cur, err := collection.FindOne(ctxFind, filter, findOptions).Decode(&result)
+	var result productsWatermark
 	err := collection.FindOne(ctxFind, filter).Decode(&result)
 	if err == mongo.ErrNoDocuments {
 		log.Printf("No %s into db.", LAST_PRODUCT_UPDATED_TIME)
-		newestProductUpdatedAt = time.Time{}
 	} else if err != nil {
-		log.Fatalf("[Error] Could not get %s from db. %v\n", LAST_PRODUCT_UPDATED_TIME, err)
+		return fmt.Errorf("Could not get %s from db. %v", LAST_PRODUCT_UPDATED_TIME, err)
 	}
-	log.Printf("%s: %v", LAST_PRODUCT_UPDATED_TIME, result.Value.Local())
-	newestProductUpdatedAt = result.Value
+	log.Printf("%s: %v", LAST_PRODUCT_UPDATED_TIME, result.UpdatedAt.Local())
+	newestProductUpdatedAt = result
+	return nil
 }
 
 // Save newest product updated at into db.
-func updateNewestProductUpdatedAt() {
-	if newestProductUpdatedAt.Equal(newestProductUpdatedAtTemp) {
-		return
-	}
-	newestProductUpdatedAt = newestProductUpdatedAtTemp
+func updateNewestProductUpdatedAt(watermark productsWatermark) error {
 	collection := client.Database("zunka").Collection("params")
-	ctx, _ := context.WithTimeout(context.Background(), 3*time.Second)
+	// Not canceled on shutdown, to keep saved state consistent.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 	filter := bson.M{"name": LAST_PRODUCT_UPDATED_TIME}
 	update := bson.M{
-		"$set": bson.M{"value": newestProductUpdatedAt},
+		"$set": bson.M{"value": watermark.UpdatedAt, "productsID": watermark.ProductsID, "skippedID": watermark.SkippedID},
 	}
 	_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
 	if err != nil {
-		log.Fatalf("Could not save %s into db.", LAST_PRODUCT_UPDATED_TIME)
+		return fmt.Errorf("Could not save %s into db. %v", LAST_PRODUCT_UPDATED_TIME, err)
 	}
-	log.Printf("Saved %s into db: %v", LAST_PRODUCT_UPDATED_TIME, newestProductUpdatedAt.In(brLocation))
+	// Only after saved, so changed products are synced again if it could not be saved.
+	newestProductUpdatedAt = watermark
+	log.Printf("Saved %s into db: %v", LAST_PRODUCT_UPDATED_TIME, watermark.UpdatedAt.In(brLocation))
+	return nil
 }
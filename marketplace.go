@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const TIME_TO_RECONCILE_MARKETPLACE_MIN = 10
+
+// Marketplace where Zunka products are listed.
+type marketplace interface {
+	name() string
+	// Zunka product field marking products to list, like marketZoom.
+	flag() string
+	// Map Zunka product to marketplace product, marked is the flag value.
+	convert(prodZunka *productZunka, marked bool) marketplaceProduct
+	listProducts(ctx context.Context) ([]marketplaceProduct, error)
+	upsertProducts(ctx context.Context, products []marketplaceProduct) (ticketID string, err error)
+	deleteProducts(ctx context.Context, productsID []string) (ticketID string, err error)
+	receipt(ctx context.Context, ticketID string) (marketplaceReceipt, error)
+}
+
+// Product at marketplace, or to be sent to marketplace.
+type marketplaceProduct struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	Price        float64      `json:"price"`
+	Quantity     int          `json:"quantity"`
+	Active       bool         `json:"active"`
+	PublishState publishState `json:"-"`
+	Payload      interface{}  `json:"-"` // Marketplace product sent.
+}
+
+// Marketplace ticket receipt.
+type marketplaceReceipt struct {
+	Finished bool                `json:"finished"`
+	Results  []marketplaceResult `json:"results"`
+}
+type marketplaceResult struct {
+	ProductID string `json:"productID"`
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+}
+
+// Marketplace reconciliation result.
+type marketplaceRun struct {
+	Marketplace string    `bson:"marketplace" json:"marketplace"`
+	DryRun      bool      `bson:"dryRun" json:"dryRun"`
+	Upserted    []string  `bson:"upserted" json:"upserted"`
+	Deleted     []string  `bson:"deleted" json:"deleted"`
+	Tickets     []string  `bson:"tickets" json:"tickets"`
+	Failed      []string  `bson:"failed" json:"failed"` // Products not accepted by tickets finished at this run.
+	Pending     int       `bson:"pending" json:"pending"`
+	StartedAt   time.Time `bson:"startedAt" json:"startedAt"`
+	FinishedAt  time.Time `bson:"finishedAt" json:"finishedAt"`
+}
+
+// Marketplace and its tickets waiting receipt.
+type marketplaceSync struct {
+	m       marketplace
+	tickets map[string]time.Time
+	mux     sync.Mutex
+}
+
+// Marketplaces, Zoom is the first.
+var marketplaces []*marketplaceSync
+
+// Zunka products and reconciliation runs persistence.
+type marketplaceStore interface {
+	// Zunka products mapped to marketplace, with products id that could not be decoded.
+	zunkaProducts(ctx context.Context, m marketplace) ([]marketplaceProduct, []string, error)
+	saveRun(ctx context.Context, run *marketplaceRun) error
+}
+
+// Zunka db.
+type mongoMarketplaceStore struct{}
+
+var marketplacesStore marketplaceStore = mongoMarketplaceStore{}
+
+// Init marketplaces, MARKETPLACES has other marketplaces to list products, comma separated.
+func initMarketplaces() {
+	marketplaces = []*marketplaceSync{newMarketplaceSync(&zoomMarketplace{})}
+	for _, name := range strings.Split(os.Getenv("MARKETPLACES"), ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "", "zoom":
+		case "fake":
+			marketplaces = append(marketplaces, newMarketplaceSync(newFakeMarketplace()))
+		default:
+			panic("Unknown marketplace " + name)
+		}
+	}
+}
+
+func newMarketplaceSync(m marketplace) *marketplaceSync {
+	return &marketplaceSync{m: m, tickets: map[string]time.Time{}}
+}
+
+// Get marketplace by name.
+func getMarketplace(name string) (*marketplaceSync, error) {
+	for _, ms := range marketplaces {
+		if ms.m.name() == name {
+			return ms, nil
+		}
+	}
+	return nil, errors.New("Unknown marketplace " + name)
+}
+
+// Get marketplace to reconcile on demand, Zoom is synced only by leader jobs, that track its tickets.
+func getReconcileMarketplace(name string) (*marketplaceSync, error) {
+	ms, err := getMarketplace(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ms.m.(*zoomMarketplace); ok {
+		return nil, errors.New("Zoom is reconciled by consistency job, run it with POST /jobs/" + JOB_CHECK_CONSISTENCY + "/run")
+	}
+	return ms, nil
+}
+
+// Reconciliation job name.
+func marketplaceJobName(ms *marketplaceSync) string {
+	return "reconcile-" + ms.m.name()
+}
+
+// Reconciliation job, Zoom is reconciled by consistency and products jobs.
+func (ms *marketplaceSync) job(ctx context.Context) error {
+	_, err := ms.reconcile(ctx, false)
+	return err
+}
+
+// Send to marketplace differences from Zunka products, run waits until sent tickets are finished.
+func (ms *marketplaceSync) reconcile(ctx context.Context, dryRun bool) (run marketplaceRun, err error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	run = marketplaceRun{
+		Marketplace: ms.m.name(),
+		DryRun:      dryRun,
+		Upserted:    []string{},
+		Deleted:     []string{},
+		Tickets:     []string{},
+		Failed:      []string{},
+		StartedAt:   time.Now(),
+	}
+	if !dryRun {
+		run.Failed = ms.checkTickets(ctx)
+		run.Pending = len(ms.tickets)
+		if run.Pending > 0 {
+			log.Printf(":: %s reconciliation waiting %d ticket(s)", ms.m.name(), run.Pending)
+			return run, nil
+		}
+	}
+
+	zunkaProducts, skippedID, err := marketplacesStore.zunkaProducts(ctx, ms.m)
+	if err != nil {
+		return run, err
+	}
+	products, err := ms.m.listProducts(ctx)
+	if err != nil {
+		return run, err
+	}
+	upsert, remove := diffMarketplaceProducts(zunkaProducts, skippedID, products)
+	for _, p := range upsert {
+		run.Upserted = append(run.Upserted, p.ID)
+	}
+	run.Deleted = remove
+
+	if !dryRun && len(upsert) > 0 {
+		ticketID, err := ms.m.upsertProducts(ctx, upsert)
+		if err != nil {
+			return run, err
+		}
+		ms.tickets[ticketID] = time.Now()
+		run.Tickets = append(run.Tickets, ticketID)
+	}
+	if !dryRun && len(remove) > 0 {
+		ticketID, err := ms.m.deleteProducts(ctx, remove)
+		if err != nil {
+			return run, err
+		}
+		ms.tickets[ticketID] = time.Now()
+		run.Tickets = append(run.Tickets, ticketID)
+	}
+	run.FinishedAt = time.Now()
+	if dryRun {
+		return run, nil
+	}
+	if len(run.Upserted) > 0 || len(run.Deleted) > 0 {
+		log.Printf(":: %s reconciled, upserted: %d, deleted: %d", ms.m.name(), len(run.Upserted), len(run.Deleted))
+	}
+	checkError(marketplacesStore.saveRun(ctx, &run))
+	return run, nil
+}
+
+// Check tickets receipt, return products not accepted.
+func (ms *marketplaceSync) checkTickets(ctx context.Context) (failed []string) {
+	failed = []string{}
+	for ticketID, sentAt := range ms.tickets {
+		if time.Since(sentAt) > ZOOM_TICKET_DEADLINE_MIN*time.Minute {
+			log.Printf("[warn] %s ticket %s given up", ms.m.name(), ticketID)
+			delete(ms.tickets, ticketID)
+			continue
+		}
+		receipt, err := ms.m.receipt(ctx, ticketID)
+		if err != nil {
+			log.Printf("[warn] Could not get %s ticket %s. %v", ms.m.name(), ticketID, err)
+			continue
+		}
+		if !receipt.Finished {
+			continue
+		}
+		for _, result := range receipt.Results {
+			if result.Status != 200 && result.Status != 201 && result.Status != 404 {
+				log.Printf("[warn] %s product %s, status: %d, message: %s", ms.m.name(), result.ProductID, result.Status, result.Message)
+				failed = append(failed, result.ProductID)
+			}
+		}
+		delete(ms.tickets, ticketID)
+	}
+	return failed
+}
+
+func (mongoMarketplaceStore) saveRun(ctx context.Context, run *marketplaceRun) error {
+	_, err := client.Database("zunka").Collection("marketplaceRuns").InsertOne(ctx, run)
+	return err
+}
+
+// Deleted products are not included.
+func (mongoMarketplaceStore) zunkaProducts(ctx context.Context, m marketplace) ([]marketplaceProduct, []string, error) {
+	projection := bson.D{}
+	for _, e := range zunkaProductProjection {
+		if e.Key != m.flag() {
+			projection = append(projection, e)
+		}
+	}
+	projection = append(projection, bson.E{m.flag(), true})
+	findOptions := options.Find()
+	findOptions.SetProjection(projection)
+	collection := client.Database("zunka").Collection("products")
+	cur, err := collection.Find(ctx, bson.D{{"deletedAt", bson.D{{"$exists", false}}}}, findOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cur.Close(ctx)
+	products := []marketplaceProduct{}
+	skippedID := []string{}
+	for cur.Next(ctx) {
+		prodZunka := productZunka{}
+		if err = cur.Decode(&prodZunka); err != nil {
+			id, _ := cur.Current.Lookup("_id").ObjectIDOK()
+			log.Printf("[warn] Skipped product %s, could not decode it. %v", id.Hex(), err)
+			skippedID = append(skippedID, id.Hex())
+			continue
+		}
+		marked, _ := cur.Current.Lookup(m.flag()).BooleanOK()
+		products = append(products, m.convert(&prodZunka, marked))
+	}
+	return products, skippedID, cur.Err()
+}
+
+// Products to upsert and products id to delete at marketplace, products that could not be decoded are kept.
+func diffMarketplaceProducts(zunkaProducts []marketplaceProduct, skippedID []string, products []marketplaceProduct) (upsert []marketplaceProduct, remove []string) {
+	upsert = []marketplaceProduct{}
+	remove = []string{}
+	listed := map[string]marketplaceProduct{}
+	for _, p := range products {
+		listed[p.ID] = p
+	}
+	zunkaIDs := map[string]bool{}
+	for _, id := range skippedID {
+		zunkaIDs[id] = true
+	}
+	for _, p := range zunkaProducts {
+		zunkaIDs[p.ID] = true
+		pm, ok := listed[p.ID]
+		if p.PublishState.remove() {
+			if ok && pm.Active {
+				remove = append(remove, p.ID)
+			}
+			continue
+		}
+		if !ok || !pm.Active || pm.Name != p.Name || pm.Quantity != p.Quantity || math.Abs(pm.Price-p.Price) > 0.001 {
+			upsert = append(upsert, p)
+		}
+	}
+	// Deleted at Zunka.
+	for _, p := range products {
+		if p.Active && !zunkaIDs[p.ID] {
+			remove = append(remove, p.ID)
+		}
+	}
+	sort.Strings(remove)
+	return upsert, remove
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// Zunka products and runs kept in memory.
+type memMarketplaceStore struct {
+	products  []marketplaceProduct
+	skippedID []string
+	runs      []marketplaceRun
+}
+
+func (s *memMarketplaceStore) zunkaProducts(ctx context.Context, m marketplace) ([]marketplaceProduct, []string, error) {
+	return s.products, s.skippedID, nil
+}
+
+func (s *memMarketplaceStore) saveRun(ctx context.Context, run *marketplaceRun) error {
+	s.runs = append(s.runs, *run)
+	return nil
+}
+
+func marketProduct(id string, price float64, quantity int, state publishState) marketplaceProduct {
+	return marketplaceProduct{ID: id, Name: "Product " + id, Price: price, Quantity: quantity, PublishState: state}
+}
+
+func listedProduct(id string, price float64, quantity int, active bool) marketplaceProduct {
+	return marketplaceProduct{ID: id, Name: "Product " + id, Price: price, Quantity: quantity, Active: active}
+}
+
+func productsIDs(products []marketplaceProduct) string {
+	ids := []string{}
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestDiffMarketplaceProducts(t *testing.T) {
+	tests := []struct {
+		name       string
+		zunka      []marketplaceProduct
+		skippedID  []string
+		listed     []marketplaceProduct
+		wantUpsert string
+		wantRemove string
+	}{
+		{"equal",
+			[]marketplaceProduct{marketProduct("a", 10, 1, PUBLISH_STATE_PUBLISHABLE)}, nil,
+			[]marketplaceProduct{listedProduct("a", 10, 1, true)}, "", ""},
+		{"not listed",
+			[]marketplaceProduct{marketProduct("a", 10, 1, PUBLISH_STATE_PUBLISHABLE)}, nil,
+			[]marketplaceProduct{}, "a", ""},
+		{"not active",
+			[]marketplaceProduct{marketProduct("a", 10, 1, PUBLISH_STATE_PUBLISHABLE)}, nil,
+			[]marketplaceProduct{listedProduct("a", 10, 1, false)}, "a", ""},
+		{"price, quantity and out of stock",
+			[]marketplaceProduct{marketProduct("a", 11, 1, PUBLISH_STATE_PUBLISHABLE), marketProduct("b", 10, 2, PUBLISH_STATE_PUBLISHABLE), marketProduct("c", 10, 0, PUBLISH_STATE_OUT_OF_STOCK)}, nil,
+			[]marketplaceProduct{listedProduct("a", 10, 1, true), listedProduct("b", 10, 1, true), listedProduct("c", 10, 3, true)}, "a,b,c", ""},
+		{"unmarked",
+			[]marketplaceProduct{marketProduct("a", 10, 0, PUBLISH_STATE_UNMARKED), marketProduct("b", 10, 0, PUBLISH_STATE_INVALID)}, nil,
+			[]marketplaceProduct{listedProduct("a", 10, 1, true), listedProduct("b", 10, 1, false)}, "", "a"},
+		{"deleted at Zunka",
+			[]marketplaceProduct{}, nil,
+			[]marketplaceProduct{listedProduct("b", 10, 1, true), listedProduct("a", 10, 1, true), listedProduct("c", 10, 1, false)}, "", "a,b"},
+		{"not decoded",
+			[]marketplaceProduct{}, []string{"a"},
+			[]marketplaceProduct{listedProduct("a", 10, 1, true)}, "", ""},
+	}
+	for _, tt := range tests {
+		upsert, remove := diffMarketplaceProducts(tt.zunka, tt.skippedID, tt.listed)
+		if got := productsIDs(upsert); got != tt.wantUpsert {
+			t.Errorf("%s: upsert = %q, want %q", tt.name, got, tt.wantUpsert)
+		}
+		if got := strings.Join(remove, ","); got != tt.wantRemove {
+			t.Errorf("%s: remove = %q, want %q", tt.name, got, tt.wantRemove)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	store := &memMarketplaceStore{
+		products: []marketplaceProduct{
+			marketProduct("a", 10, 1, PUBLISH_STATE_PUBLISHABLE),
+			marketProduct("b", 20, 2, PUBLISH_STATE_PUBLISHABLE),
+			marketProduct("c", 30, 0, PUBLISH_STATE_UNMARKED),
+		},
+		skippedID: []string{"e"},
+	}
+	oldStore := marketplacesStore
+	marketplacesStore = store
+	defer func() { marketplacesStore = oldStore }()
+
+	fake := newFakeMarketplace()
+	for _, p := range []marketplaceProduct{listedProduct("b", 20, 2, true), listedProduct("c", 30, 1, true), listedProduct("d", 40, 1, true), listedProduct("e", 50, 1, true)} {
+		fake.products[p.ID] = p
+	}
+	ms := newMarketplaceSync(fake)
+	ctx := context.Background()
+
+	// Dry run not send.
+	run, err := ms.reconcile(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(run.Upserted, ",") != "a" || strings.Join(run.Deleted, ",") != "c,d" || len(run.Tickets) != 0 {
+		t.Fatalf("dry run = %+v", run)
+	}
+	if fake.tickets != 0 || len(store.runs) != 0 {
+		t.Fatalf("dry run sent %d ticket(s), saved %d run(s)", fake.tickets, len(store.runs))
+	}
+
+	run, err = ms.reconcile(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Tickets) != 2 || len(ms.tickets) != 2 {
+		t.Fatalf("run tickets = %v, waiting = %d, want 2", run.Tickets, len(ms.tickets))
+	}
+	if !fake.products["a"].Active || fake.products["c"].Active || fake.products["d"].Active || !fake.products["e"].Active {
+		t.Errorf("fake products = %+v", fake.products)
+	}
+
+	// Tickets finished, nothing to send.
+	run, err = ms.reconcile(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Upserted) != 0 || len(run.Deleted) != 0 || len(run.Failed) != 0 || len(ms.tickets) != 0 {
+		t.Errorf("second run = %+v", run)
+	}
+	if len(store.runs) != 2 {
+		t.Errorf("runs saved = %d, want 2", len(store.runs))
+	}
+}
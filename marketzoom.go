@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const MARKET_ZOOM_PREVIEW_LIMIT = 1000
+
+// Set or clear marketZoom for many products.
+type marketZoomChange struct {
+	Enable   bool     `json:"enable"`
+	IDs      []string `json:"ids"`
+	Category string   `json:"category"`
+	Query    string   `json:"query"` // MongoDB filter as extended JSON.
+	DryRun   bool     `json:"dryRun"`
+	User     string   `json:"user"` // Who asked the change, for audit.
+}
+
+// Product to be changed.
+type marketZoomProduct struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Bulk marketZoom change result.
+type marketZoomResult struct {
+	Enable   bool                `json:"enable"`
+	DryRun   bool                `json:"dryRun"`
+	Matched  int                 `json:"matched"`  // Products selected.
+	Changed  int                 `json:"changed"`  // Products with marketZoom different, changed if not dry run.
+	Products []marketZoomProduct `json:"products"` // Products to change, limited on dry run.
+}
+
+// Bulk marketZoom change audit.
+type marketZoomAudit struct {
+	Enable     bool      `bson:"enable"`
+	ProductsID []string  `bson:"productsID"`
+	IDs        []string  `bson:"ids,omitempty"`
+	Category   string    `bson:"category,omitempty"`
+	Query      string    `bson:"query,omitempty"`
+	User       string    `bson:"user"`
+	CreatedAt  time.Time `bson:"createdAt"`
+}
+
+// Set or clear marketZoom, updatedAt is changed so next sync send products to Zoom.
+func changeMarketZoom(ctx context.Context, change *marketZoomChange) (result marketZoomResult, err error) {
+	result = marketZoomResult{
+		Enable:   change.Enable,
+		DryRun:   change.DryRun,
+		Products: []marketZoomProduct{},
+	}
+	filter, err := marketZoomFilter(change)
+	if err != nil {
+		return result, err
+	}
+	collection := client.Database("zunka").Collection("products")
+	matched, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return result, err
+	}
+	result.Matched = int(matched)
+
+	// Products to change.
+	filterChange := bson.D{
+		{"$and", bson.A{
+			filter,
+			bson.D{{"marketZoom", bson.D{{"$ne", change.Enable}}}},
+		}},
+	}
+	findOptions := options.Find()
+	findOptions.SetProjection(bson.D{{"_id", true}, {"storeProductTitle", true}})
+	findOptions.SetSort(bson.D{{"_id", 1}})
+	cur, err := collection.Find(ctx, filterChange, findOptions)
+	if err != nil {
+		return result, err
+	}
+	defer cur.Close(ctx)
+	objectIDs := []primitive.ObjectID{}
+	productsID := []string{}
+	for cur.Next(ctx) {
+		doc := struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Title string             `bson:"storeProductTitle"`
+		}{}
+		if err = cur.Decode(&doc); err != nil {
+			return result, err
+		}
+		objectIDs = append(objectIDs, doc.ID)
+		productsID = append(productsID, doc.ID.Hex())
+		if !change.DryRun || len(result.Products) < MARKET_ZOOM_PREVIEW_LIMIT {
+			result.Products = append(result.Products, marketZoomProduct{ID: doc.ID.Hex(), Title: doc.Title})
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return result, err
+	}
+	result.Changed = len(objectIDs)
+	if change.DryRun || len(objectIDs) == 0 {
+		return result, nil
+	}
+
+	// Change products.
+	update := bson.D{
+		{"$set", bson.D{
+			{"marketZoom", change.Enable},
+			{"updatedAt", time.Now()},
+		}},
+	}
+	_, err = collection.UpdateMany(ctx, bson.D{{"_id", bson.D{{"$in", objectIDs}}}}, update)
+	if err != nil {
+		return result, err
+	}
+	log.Printf(":: marketZoom set to %v by %s, products (%d): %s", change.Enable, change.User, len(productsID), strings.Join(productsID, ", "))
+
+	// Audit.
+	audit := marketZoomAudit{
+		Enable:     change.Enable,
+		ProductsID: productsID,
+		IDs:        change.IDs,
+		Category:   change.Category,
+		Query:      change.Query,
+		User:       change.User,
+		CreatedAt:  time.Now(),
+	}
+	_, err = client.Database("zunka").Collection("zoomMarketAudit").InsertOne(ctx, audit)
+	checkError(err)
+	return result, nil
+}
+
+// Filter for products selected by ids, category and query, deleted products are not selected.
+func marketZoomFilter(change *marketZoomChange) (bson.D, error) {
+	if len(change.IDs) == 0 && change.Category == "" && change.Query == "" {
+		return nil, errors.New("No products selected, ids, category or query must be informed")
+	}
+	filters := bson.A{
+		bson.D{{"deletedAt", bson.D{{"$exists", false}}}},
+	}
+	if len(change.IDs) > 0 {
+		objectIDs, err := zunkaObjectIDs(change.IDs)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, bson.D{{"_id", bson.D{{"$in", objectIDs}}}})
+	}
+	if change.Category != "" {
+		filters = append(filters, bson.D{{"storeProductCategory", change.Category}})
+	}
+	if change.Query != "" {
+		query := bson.D{}
+		err := bson.UnmarshalExtJSON([]byte(change.Query), false, &query)
+		if err != nil {
+			return nil, errors.New("Invalid query. " + err.Error())
+		}
+		filters = append(filters, query)
+	}
+	return bson.D{{"$and", filters}}, nil
+}
+
+// Read products id from csv, first column, header and empty lines are skipped.
+func readMarketZoomIDs(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	ids := []string{}
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 {
+			continue
+		}
+		// Csv from spreadsheet may start with byte order mark.
+		id := strings.TrimSpace(strings.TrimPrefix(record[0], "\ufeff"))
+		if id == "" {
+			continue
+		}
+		header := first && marketZoomIDHeader(id)
+		first = false
+		if header {
+			continue
+		}
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			return nil, errors.New("Invalid product id " + id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Product id column name.
+func marketZoomIDHeader(column string) bool {
+	switch strings.ToLower(column) {
+	case "id", "_id", "product_id", "productid":
+		return true
+	}
+	return false
+}
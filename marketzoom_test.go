@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReadMarketZoomIDs(t *testing.T) {
+	id1, id2 := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+	tests := []struct {
+		name    string
+		csv     string
+		want    []string
+		wantErr bool
+	}{
+		{"ids", id1 + "\n" + id2 + "\n", []string{id1, id2}, false},
+		{"header", "id,title\n" + id1 + ",Notebook\n", []string{id1}, false},
+		{"header with byte order mark", "\ufeffproduct_id\n" + id2 + "\n", []string{id2}, false},
+		{"id with byte order mark", "\ufeff" + id1 + "\n", []string{id1}, false},
+		{"empty lines and spaces", "\n_id\n\n  " + id1 + "  \n,\n", []string{id1}, false},
+		{"empty", "", []string{}, false},
+		{"invalid first line", "12345\n" + id1 + "\n", nil, true},
+		{"header not at first line", id1 + "\nid\n", nil, true},
+		{"invalid id", id1 + "\nnot an id\n", nil, true},
+		{"invalid csv", "\"" + id1 + "\n", nil, true},
+	}
+	for _, tt := range tests {
+		ids, err := readMarketZoomIDs(strings.NewReader(tt.csv))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: readMarketZoomIDs() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: readMarketZoomIDs() = %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
+
+func TestMarketZoomFilter(t *testing.T) {
+	objectID := primitive.NewObjectID()
+	notDeleted := bson.D{{"deletedAt", bson.D{{"$exists", false}}}}
+	tests := []struct {
+		name    string
+		change  marketZoomChange
+		want    bson.A
+		wantErr bool
+	}{
+		{"nothing selected", marketZoomChange{Enable: true}, nil, true},
+		{"ids", marketZoomChange{IDs: []string{objectID.Hex()}},
+			bson.A{notDeleted, bson.D{{"_id", bson.D{{"$in", []primitive.ObjectID{objectID}}}}}}, false},
+		{"invalid id", marketZoomChange{IDs: []string{"1"}}, nil, true},
+		{"category", marketZoomChange{Category: "Notebooks"},
+			bson.A{notDeleted, bson.D{{"storeProductCategory", "Notebooks"}}}, false},
+		{"query", marketZoomChange{Query: `{"storeProductQtd": {"$gt": 0}}`},
+			bson.A{notDeleted, bson.D{{"storeProductQtd", bson.D{{"$gt", int32(0)}}}}}, false},
+		{"invalid query", marketZoomChange{Query: `{"storeProductQtd": `}, nil, true},
+		{"category and query", marketZoomChange{Category: "Notebooks", Query: `{"marketZoom": false}`},
+			bson.A{notDeleted, bson.D{{"storeProductCategory", "Notebooks"}}, bson.D{{"marketZoom", false}}}, false},
+	}
+	for _, tt := range tests {
+		filter, err := marketZoomFilter(&tt.change)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: marketZoomFilter() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		got, err := bson.MarshalExtJSON(filter, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := bson.MarshalExtJSON(bson.D{{"$and", tt.want}}, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s: marketZoomFilter() = %s, want %s", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const NOTIFY_TIMEOUT_S = 10
+
+// Alert keys, alerts with same key are deduplicated.
+const (
+	ALERT_CONSISTENCY      = "consistency-failed"
+	ALERT_NOT_CONVERGING   = "consistency-not-converging"
+	ALERT_TICKET_GIVEN_UP  = "ticket-given-up"
+	ALERT_RECEIPT_FAILURES = "receipt-failures"
+	ALERT_ORPHAN_PRODUCTS  = "orphan-products"
+	ALERT_ACTIVE_DRIFT     = "active-drift"
+)
+
+// Alert sent to notifiers.
+type alert struct {
+	Key        string    `json:"key"`
+	Subject    string    `json:"subject"`
+	Message    string    `json:"message"`
+	Suppressed int       `json:"suppressed"` // Alerts with same key not sent at quiet period.
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Alert notifier.
+type notifier interface {
+	name() string
+	notify(ctx context.Context, a *alert) error
+}
+
+// Email notifier.
+type smtpNotifier struct {
+	addr string // host:port
+	from string
+	to   []string
+	user string
+	pass string
+}
+
+// Generic webhook notifier, alert is posted as json.
+type webhookNotifier struct {
+	url string
+}
+
+// Telegram bot notifier.
+type telegramNotifier struct {
+	api    string
+	token  string
+	chatID string
+}
+
+// Last alert sent by key.
+type alertState struct {
+	sentAt     time.Time
+	suppressed int
+}
+
+var notifiers []notifier
+var alertsState = map[string]*alertState{}
+var muxAlerts sync.Mutex
+
+// Consistency passes failed in sequence.
+var consistencyFailedPasses int
+
+// Consistency passes in sequence with product at diff, by product id.
+var consistencyDiffPasses = map[string]int{}
+
+// Init notifiers from env.
+func initNotifiers() {
+	notifiers = []notifier{}
+	// ZOOM_ALERT_SMTP_ADDR=localhost:1025
+	if addr := os.Getenv("ZOOM_ALERT_SMTP_ADDR"); addr != "" {
+		notifiers = append(notifiers, &smtpNotifier{
+			addr: addr,
+			from: os.Getenv("ZOOM_ALERT_SMTP_FROM"),
+			to:   strings.Split(os.Getenv("ZOOM_ALERT_SMTP_TO"), ","),
+			user: os.Getenv("ZOOM_ALERT_SMTP_USER"),
+			pass: os.Getenv("ZOOM_ALERT_SMTP_PASS"),
+		})
+	}
+	if url := os.Getenv("ZOOM_ALERT_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, &webhookNotifier{url: url})
+	}
+	if token := os.Getenv("ZOOM_ALERT_TELEGRAM_TOKEN"); token != "" {
+		// Other api to use a local server.
+		api := os.Getenv("ZOOM_ALERT_TELEGRAM_API")
+		if api == "" {
+			api = "https://api.telegram.org"
+		}
+		notifiers = append(notifiers, &telegramNotifier{
+			api:    strings.TrimSuffix(api, "/"),
+			token:  token,
+			chatID: os.Getenv("ZOOM_ALERT_TELEGRAM_CHAT_ID"),
+		})
+	}
+	for _, n := range notifiers {
+		log.Printf("Alert notifier: %s", n.name())
+	}
+}
+
+// Send alert, alert with same key is not sent again at quiet period.
+func sendAlert(key string, subject string, message string) {
+	muxAlerts.Lock()
+	state, ok := alertsState[key]
+	if !ok {
+		state = &alertState{}
+		alertsState[key] = state
+	}
+	if time.Since(state.sentAt) < time.Duration(config.Alerts.QuietPeriodMin)*time.Minute {
+		state.suppressed++
+		muxAlerts.Unlock()
+		log.Printf("[warn] Alert %s suppressed, %s", key, subject)
+		return
+	}
+	a := &alert{
+		Key:        key,
+		Subject:    subject,
+		Message:    message,
+		Suppressed: state.suppressed,
+		CreatedAt:  time.Now(),
+	}
+	state.sentAt = a.CreatedAt
+	state.suppressed = 0
+	muxAlerts.Unlock()
+
+	log.Printf("[warn] Alert %s, %s", key, subject)
+	// Not block sync.
+	go notifyAll(a)
+}
+
+// Send alert to all notifiers.
+func notifyAll(a *alert) (ok bool) {
+	ok = true
+	for _, n := range notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), NOTIFY_TIMEOUT_S*time.Second)
+		err := n.notify(ctx, a)
+		cancel()
+		if err != nil {
+			ok = false
+			log.Printf("[error] Could not send alert %s by %s. %v", a.Key, n.name(), err)
+		}
+	}
+	return ok
+}
+
+// Alert text.
+func (a *alert) text() string {
+	s := fmt.Sprintf("[zoomproducts] %s\n\n%s\n", a.Subject, a.Message)
+	if a.Suppressed > 0 {
+		s += fmt.Sprintf("\n%d similar alert(s) suppressed.\n", a.Suppressed)
+	}
+	return s
+}
+
+func (n *smtpNotifier) name() string {
+	return "smtp " + n.addr
+}
+
+// Send email, like smtp.SendMail, but limited by context.
+func (n *smtpNotifier) notify(ctx context.Context, a *alert) error {
+	host, _, err := net.SplitHostPort(n.addr)
+	if err != nil {
+		return err
+	}
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.user != "" {
+		if err = c.Auth(smtp.PlainAuth("", n.user, n.pass, host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [zoomproducts] %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		n.from, strings.Join(n.to, ", "), a.Subject, strings.Replace(a.text(), "\n", "\r\n", -1))
+	if _, err = w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (n *webhookNotifier) name() string {
+	return "webhook " + n.url
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, a *alert) error {
+	return postNotification(ctx, n.url, a)
+}
+
+func (n *telegramNotifier) name() string {
+	return "telegram"
+}
+
+func (n *telegramNotifier) notify(ctx context.Context, a *alert) error {
+	body := struct {
+		ChatID string `json:"chat_id"`
+		Text   string `json:"text"`
+	}{n.chatID, a.text()}
+	return postNotification(ctx, n.api+"/bot"+n.token+"/sendMessage", body)
+}
+
+// Post json notification.
+func postNotification(ctx context.Context, url string, v interface{}) error {
+	bodyJSON, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(bodyJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	resBody, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("status: %v, body: %s", res.StatusCode, string(resBody))
+	}
+	return nil
+}
+
+/******************************************************************************
+* ALERTS
+******************************************************************************/
+// Consistency pass could not get or push products.
+func alertConsistencyFailed(reason string) {
+	consistencyFailedPasses++
+	if consistencyFailedPasses >= config.Alerts.ConsistencyFailures {
+		sendAlert(ALERT_CONSISTENCY, fmt.Sprintf("Consistency failed %d times in sequence", consistencyFailedPasses), reason)
+	}
+}
+
+// Consistency pass finished, diffID are products pushed to Zoom.
+// Products pushed in sequence at each pass are not converging.
+func alertConsistencyPass(diffID []string) {
+	consistencyFailedPasses = 0
+	passes := map[string]int{}
+	notConverging := []string{}
+	for _, id := range diffID {
+		passes[id] = consistencyDiffPasses[id] + 1
+		if passes[id] >= config.Alerts.ConsistencyFailures {
+			notConverging = append(notConverging, id)
+		}
+	}
+	consistencyDiffPasses = passes
+	if len(notConverging) == 0 {
+		return
+	}
+	sort.Strings(notConverging)
+	sendAlert(ALERT_NOT_CONVERGING, fmt.Sprintf("%d product(s) different at Zoom after %d consistency passes", len(notConverging), config.Alerts.ConsistencyFailures),
+		strings.Join(notConverging, "\n"))
+}
+
+// Products at Zoom never existed at Zunka.
+func alertOrphanProducts(productsID []string) {
+	if len(productsID) == 0 {
+		return
+	}
+	sendAlert(ALERT_ORPHAN_PRODUCTS, fmt.Sprintf("%d product(s) at Zoom not found at Zunka", len(productsID)), strings.Join(productsID, "\n"))
+}
+
+// Active products at Zoom different from products that must be at Zoom.
+func alertActiveDrift(zunkaActive int, zoomActive int) {
+	drift := zunkaActive - zoomActive
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift <= config.Alerts.ActiveDrift {
+		return
+	}
+	sendAlert(ALERT_ACTIVE_DRIFT, fmt.Sprintf("Active products drift of %d", drift), fmt.Sprintf("Zunka products available: %d\nActive products at Zoom: %d", zunkaActive, zoomActive))
+}
+
+// Ticket given up.
+func alertTicketGivenUp(ticket *zoomTicket) {
+	sendAlert(ALERT_TICKET_GIVEN_UP, fmt.Sprintf("Ticket %s given up after %d minutes", ticket.ID, ZOOM_TICKET_DEADLINE_MIN),
+		fmt.Sprintf("Products (%d): %s", len(ticket.ProductsID), strings.Join(ticket.ProductsID, ", ")))
+}
+
+// Receipt with failed products above threshold.
+func alertReceiptFailures(ticket *zoomTicket, failed []string, total int) {
+	if total == 0 || len(failed) == 0 {
+		return
+	}
+	percent := float64(len(failed)) * 100 / float64(total)
+	if percent <= config.Alerts.ReceiptFailurePercent {
+		return
+	}
+	sendAlert(ALERT_RECEIPT_FAILURES, fmt.Sprintf("Ticket %s with %.0f%% of products failed", ticket.ID, percent),
+		fmt.Sprintf("Failed products (%d of %d): %s", len(failed), total, strings.Join(failed, ", ")))
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAlert() *alert {
+	return &alert{Key: "test", Subject: "Test subject", Message: "Test message", Suppressed: 2, CreatedAt: time.Now()}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"ok", http.StatusOK, false},
+		{"no content", http.StatusNoContent, false},
+		{"error", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		received := alert{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("%s: request %s %s", tt.name, r.Method, r.Header.Get("Content-Type"))
+			}
+			json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(tt.status)
+		}))
+		n := &webhookNotifier{url: ts.URL}
+		err := n.notify(context.Background(), testAlert())
+		ts.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: notify() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if received.Key != "test" || received.Subject != "Test subject" || received.Suppressed != 2 {
+			t.Errorf("%s: received = %+v", tt.name, received)
+		}
+	}
+}
+
+func TestWebhookNotifierTimeout(t *testing.T) {
+	release := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	n := &webhookNotifier{url: ts.URL}
+	if err := n.notify(ctx, testAlert()); err == nil {
+		t.Errorf("notify() without response, want error")
+	}
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	body := struct {
+		ChatID string `json:"chat_id"`
+		Text   string `json:"text"`
+	}{}
+	path := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer ts.Close()
+	n := &telegramNotifier{api: ts.URL, token: "123:abc", chatID: "42"}
+	if err := n.notify(context.Background(), testAlert()); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %s", path)
+	}
+	if body.ChatID != "42" || !strings.Contains(body.Text, "Test subject") || !strings.Contains(body.Text, "2 similar alert(s) suppressed") {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+// Minimal smtp server, return received message.
+func fakeSMTPServer(l net.Listener, received chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	data := false
+	msg := ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if data {
+			if line == ".\r\n" {
+				data = false
+				received <- msg
+				reply("250 OK")
+				continue
+			}
+			msg += line
+			continue
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			data = true
+			reply("354 Go ahead")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go fakeSMTPServer(l, received)
+
+	n := &smtpNotifier{addr: l.Addr().String(), from: "zoom@zunka.com.br", to: []string{"a@zunka.com.br", "b@zunka.com.br"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = n.notify(ctx, testAlert()); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-received
+	if !strings.Contains(msg, "Subject: [zoomproducts] Test subject") || !strings.Contains(msg, "To: a@zunka.com.br, b@zunka.com.br") {
+		t.Errorf("message = %s", msg)
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// Server accept connection but not reply.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+	n := &smtpNotifier{addr: l.Addr().String(), from: "zoom@zunka.com.br", to: []string{"a@zunka.com.br"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err = n.notify(ctx, testAlert()); err == nil {
+		t.Errorf("notify() without reply, want error")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("notify() took %v, context not respected", time.Since(start))
+	}
+}
+
+func TestSendAlertQuietPeriod(t *testing.T) {
+	received := make(chan alert, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := alert{}
+		json.NewDecoder(r.Body).Decode(&a)
+		received <- a
+	}))
+	defer ts.Close()
+
+	oldConfig, oldNotifiers := config, notifiers
+	defer func() { config, notifiers = oldConfig, oldNotifiers }()
+	config = defaultConfig()
+	config.Alerts.QuietPeriodMin = 60
+	notifiers = []notifier{&webhookNotifier{url: ts.URL}}
+	muxAlerts.Lock()
+	alertsState = map[string]*alertState{}
+	muxAlerts.Unlock()
+
+	sendAlert("k1", "First", "")
+	sendAlert("k1", "Suppressed", "")
+	sendAlert("k2", "Other key", "")
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case a := <-received:
+			got[a.Subject] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("alert not received")
+		}
+	}
+	if !got["First"] || !got["Other key"] {
+		t.Errorf("received = %v", got)
+	}
+	select {
+	case a := <-received:
+		t.Errorf("alert %s sent at quiet period", a.Subject)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Suppressed count sent with next alert after quiet period.
+	muxAlerts.Lock()
+	alertsState["k1"].sentAt = time.Now().Add(-61 * time.Minute)
+	muxAlerts.Unlock()
+	sendAlert("k1", "After quiet period", "")
+	select {
+	case a := <-received:
+		if a.Subject != "After quiet period" || a.Suppressed != 1 {
+			t.Errorf("alert = %+v, want 1 suppressed", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("alert not received")
+	}
+}
+
+func TestAlertConsistencyPass(t *testing.T) {
+	received := make(chan alert, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := alert{}
+		json.NewDecoder(r.Body).Decode(&a)
+		received <- a
+	}))
+	defer ts.Close()
+
+	oldConfig, oldNotifiers := config, notifiers
+	defer func() { config, notifiers = oldConfig, oldNotifiers }()
+	config = defaultConfig()
+	config.Alerts.QuietPeriodMin = 0
+	config.Alerts.ConsistencyFailures = 3
+	notifiers = []notifier{&webhookNotifier{url: ts.URL}}
+	muxAlerts.Lock()
+	alertsState = map[string]*alertState{}
+	muxAlerts.Unlock()
+	consistencyFailedPasses = 0
+	consistencyDiffPasses = map[string]int{}
+
+	// Pushed diffs, different products at each pass, is not a failure.
+	alertConsistencyPass([]string{"1", "2"})
+	alertConsistencyPass([]string{"3"})
+	alertConsistencyPass([]string{"4", "1"})
+	alertConsistencyPass([]string{"5"})
+	select {
+	case a := <-received:
+		t.Fatalf("alert %s sent for converging passes", a.Subject)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if consistencyFailedPasses != 0 {
+		t.Errorf("consistencyFailedPasses = %d, want 0", consistencyFailedPasses)
+	}
+
+	// Same product at diff in sequence.
+	alertConsistencyPass([]string{"5", "6"})
+	alertConsistencyPass([]string{"5", "7"})
+	select {
+	case a := <-received:
+		if a.Key != ALERT_NOT_CONVERGING || a.Message != "5" {
+			t.Errorf("alert = %+v, want product 5 not converging", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("alert not received")
+	}
+
+	// Failed passes in sequence, a finished pass resets the count.
+	alertConsistencyFailed("first")
+	alertConsistencyFailed("second")
+	alertConsistencyPass(nil)
+	alertConsistencyFailed("first")
+	alertConsistencyFailed("second")
+	select {
+	case a := <-received:
+		t.Fatalf("alert %s sent before failures threshold", a.Subject)
+	case <-time.After(100 * time.Millisecond):
+	}
+	alertConsistencyFailed("third")
+	select {
+	case a := <-received:
+		if a.Key != ALERT_CONSISTENCY || a.Message != "third" {
+			t.Errorf("alert = %+v, want consistency failed", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("alert not received")
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	TIME_TO_CHECK_ORDERS_MIN = 5
+	ORDERS_LIST_LIMIT        = 100
+	// Newest order received time db param name.
+	ORDERS_SINCE = "ZOOMPRODUCTS-orders-since"
+)
+
+// Orders modes.
+const (
+	ORDERS_MODE_NONE    = "none"
+	ORDERS_MODE_POLLING = "polling"
+	ORDERS_MODE_WEBHOOK = "webhook"
+)
+
+// Orders source.
+const (
+	ORDER_SOURCE_POLLING = "polling"
+	ORDER_SOURCE_WEBHOOK = "webhook"
+)
+
+// Orders mode.
+var ordersMode string
+
+// Orders and Zunka stock persistence.
+type orderStore interface {
+	// Which Zunka products exist.
+	productsExist(ctx context.Context, productsID []string) (map[string]bool, error)
+	// Insert order, false if order already exist.
+	insertOrder(ctx context.Context, o *order) (bool, error)
+	// Set item stock decremented, false if it was already set to same value.
+	setItemStockDecremented(ctx context.Context, orderID string, item int, decremented bool) (bool, error)
+	decrementStock(ctx context.Context, productID string, quantity int) error
+}
+
+// Orders at Zunka db.
+type mongoOrderStore struct{}
+
+var ordersStore orderStore = mongoOrderStore{}
+
+// Order received from Zoom.
+type zoomOrderR struct {
+	ID        string   `json:"order_id"`
+	Status    string   `json:"status"`
+	CreatedAt zoomTime `json:"created_at"`
+	Total     float64  `json:"total"`
+	Items     []struct {
+		ProductID string  `json:"product_id"`
+		Name      string  `json:"name"`
+		Quantity  int     `json:"quantity"`
+		Price     float64 `json:"price"`
+	} `json:"items"`
+}
+
+// Marketplace order.
+type order struct {
+	ID          string      `bson:"_id" json:"id"`
+	Marketplace string      `bson:"marketplace" json:"marketplace"`
+	Status      string      `bson:"status" json:"status"`
+	Total       float64     `bson:"total" json:"total"`
+	Items       []orderItem `bson:"items" json:"items"`
+	Source      string      `bson:"source" json:"source"`
+	Payload     string      `bson:"payload" json:"payload"` // Order as received.
+	OrderedAt   time.Time   `bson:"orderedAt" json:"orderedAt"`
+	ReceivedAt  time.Time   `bson:"receivedAt" json:"receivedAt"`
+	// Status set by Zunka and reported to Zoom.
+	ZunkaStatus    string         `bson:"zunkaStatus" json:"zunkaStatus"`
+	Invoice        *orderInvoice  `bson:"invoice,omitempty" json:"invoice,omitempty"`
+	Shipment       *orderShipment `bson:"shipment,omitempty" json:"shipment,omitempty"`
+	DeliveredAt    time.Time      `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+	ZoomStatusSent string         `bson:"zoomStatusSent" json:"zoomStatusSent"`
+	StatusTicketID string         `bson:"statusTicketID" json:"statusTicketID"` // Waiting ticket.
+	StatusError    string         `bson:"statusError" json:"statusError"`
+	StatusFailures int            `bson:"statusFailures" json:"statusFailures"` // Sent again with backoff.
+	StatusRetryAt  time.Time      `bson:"statusRetryAt,omitempty" json:"statusRetryAt,omitempty"`
+}
+
+// Marketplace order item.
+type orderItem struct {
+	ProductID        string  `bson:"productID" json:"productID"`
+	Name             string  `bson:"name" json:"name"`
+	Quantity         int     `bson:"quantity" json:"quantity"`
+	Price            float64 `bson:"price" json:"price"`
+	ProductFound     bool    `bson:"productFound" json:"productFound"`
+	StockDecremented bool    `bson:"stockDecremented" json:"stockDecremented"`
+}
+
+// Init orders mode.
+func initOrdersMode() {
+	// ZOOM_ORDERS_MODE=none|polling|webhook
+	ordersMode = os.Getenv("ZOOM_ORDERS_MODE")
+	if ordersMode == "" {
+		ordersMode = ORDERS_MODE_NONE
+	}
+	if ordersMode != ORDERS_MODE_NONE && ordersMode != ORDERS_MODE_POLLING && ordersMode != ORDERS_MODE_WEBHOOK {
+		panic("ZOOM_ORDERS_MODE must be none, polling or webhook.")
+	}
+}
+
+// Check new orders at Zoom.
+func checkOrders(ctx context.Context) error {
+	// Orders received by webhook.
+	if ordersMode != ORDERS_MODE_POLLING {
+		return processPendingOrders(ctx)
+	}
+	since, err := getOrdersSince()
+	if err != nil {
+		return err
+	}
+	payloads, err := getZoomOrders(ctx, since)
+	if err != nil {
+		return err
+	}
+	newest, err := receiveOrders(ctx, payloads, ORDER_SOURCE_POLLING)
+	if err != nil {
+		return err
+	}
+	if newest.After(since) {
+		saveOrdersSince(newest)
+	}
+	// Retry orders not finished before.
+	return processPendingOrders(ctx)
+}
+
+// Get Zoom orders created since time, all orders if since is zero.
+func getZoomOrders(ctx context.Context, since time.Time) ([]json.RawMessage, error) {
+	path := "/orders"
+	if !since.IsZero() {
+		path += "?since=" + url.QueryEscape(since.Format("2006-01-02T15:04:05"))
+	}
+	resBody, err := zoomRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := struct {
+		Orders []json.RawMessage `json:"orders"`
+	}{}
+	err = json.Unmarshal(resBody, &result)
+	return result.Orders, err
+}
+
+// Parse orders from webhook, a order or a list of orders.
+func parseOrdersPayload(body []byte) ([]json.RawMessage, error) {
+	result := struct {
+		Orders []json.RawMessage `json:"orders"`
+	}{}
+	err := json.Unmarshal(body, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Orders) > 0 {
+		return result.Orders, nil
+	}
+	return []json.RawMessage{body}, nil
+}
+
+// Save orders and decrement stock, return newest order time.
+func receiveOrders(ctx context.Context, payloads []json.RawMessage, source string) (newest time.Time, err error) {
+	for _, payload := range payloads {
+		o, err := parseZoomOrder(payload, source)
+		if err != nil {
+			return newest, err
+		}
+		if o.OrderedAt.After(newest) {
+			newest = o.OrderedAt
+		}
+		isNew, err := saveOrder(ctx, o)
+		if err != nil {
+			return newest, err
+		}
+		// Already received.
+		if !isNew {
+			continue
+		}
+		log.Printf(":: Order %s received (%s), items: %d", o.ID, source, len(o.Items))
+		if err = decrementOrderStock(ctx, o); err != nil {
+			return newest, err
+		}
+	}
+	return newest, nil
+}
+
+// Parse order received from Zoom.
+func parseZoomOrder(payload []byte, source string) (*order, error) {
+	orderR := zoomOrderR{}
+	err := json.Unmarshal(payload, &orderR)
+	if err != nil {
+		return nil, err
+	}
+	if orderR.ID == "" {
+		return nil, errors.New("Order without id: " + string(payload))
+	}
+	o := order{
+		ID:          orderR.ID,
+		Marketplace: "zoom",
+		Status:      orderR.Status,
+		Total:       orderR.Total,
+		Items:       []orderItem{},
+		Source:      source,
+		Payload:     string(payload),
+		OrderedAt:   orderR.CreatedAt.Time,
+		ReceivedAt:  time.Now(),
+	}
+	for _, item := range orderR.Items {
+		o.Items = append(o.Items, orderItem{
+			ProductID: item.ProductID,
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		})
+	}
+	return &o, nil
+}
+
+// Save order, false if order already exist.
+func saveOrder(ctx context.Context, o *order) (bool, error) {
+	// Products at Zunka.
+	productsID := []string{}
+	for _, item := range o.Items {
+		productsID = append(productsID, item.ProductID)
+	}
+	found, err := ordersStore.productsExist(ctx, productsID)
+	if err != nil {
+		return false, err
+	}
+	for i := range o.Items {
+		o.Items[i].ProductFound = found[o.Items[i].ProductID]
+		if !o.Items[i].ProductFound {
+			log.Printf("[warn] Order %s, product %s not found at Zunka", o.ID, o.Items[i].ProductID)
+		}
+	}
+
+	return ordersStore.insertOrder(ctx, o)
+}
+
+func (mongoOrderStore) insertOrder(ctx context.Context, o *order) (bool, error) {
+	collection := client.Database("zunka").Collection("zoomOrders")
+	_, err := collection.InsertOne(ctx, o)
+	if isDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (mongoOrderStore) productsExist(ctx context.Context, productsID []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	// Zoom product id may be not a Zunka id.
+	objectIDs := []primitive.ObjectID{}
+	for _, id := range productsID {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	if len(objectIDs) == 0 {
+		return found, nil
+	}
+	collection := client.Database("zunka").Collection("products")
+	findOptions := options.Find().SetProjection(bson.D{{"_id", true}})
+	cur, err := collection.Find(ctx, bson.D{{"_id", bson.D{{"$in", objectIDs}}}}, findOptions)
+	if err != nil {
+		return found, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		found[cur.Current.Lookup("_id").ObjectID().Hex()] = true
+	}
+	return found, cur.Err()
+}
+
+func (mongoOrderStore) setItemStockDecremented(ctx context.Context, orderID string, item int, decremented bool) (bool, error) {
+	collection := client.Database("zunka").Collection("zoomOrders")
+	itemField := fmt.Sprintf("items.%d.stockDecremented", item)
+	res, err := collection.UpdateOne(ctx,
+		bson.D{{"_id", orderID}, {itemField, !decremented}},
+		bson.D{{"$set", bson.D{{itemField, decremented}}}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// Changed updatedAt, so new quantity is sent to Zoom.
+func (mongoOrderStore) decrementStock(ctx context.Context, productID string, quantity int) error {
+	collection := client.Database("zunka").Collection("products")
+	_, err := collection.UpdateOne(ctx,
+		bson.D{{"_id", zunkaObjectID(productID)}},
+		bson.D{
+			{"$inc", bson.D{{"storeProductQtd", -quantity}}},
+			{"$set", bson.D{{"updatedAt", time.Now()}}},
+		})
+	return err
+}
+
+// Decrement Zunka stock for order items, each item is decremented only once.
+func decrementOrderStock(ctx context.Context, o *order) error {
+	for i, item := range o.Items {
+		if !item.ProductFound || item.StockDecremented || item.Quantity <= 0 {
+			continue
+		}
+		// Mark item before decrement, so stock is not decremented twice.
+		marked, err := ordersStore.setItemStockDecremented(ctx, o.ID, i, true)
+		if err != nil {
+			return err
+		}
+		if !marked {
+			continue
+		}
+		err = ordersStore.decrementStock(ctx, item.ProductID, item.Quantity)
+		if err != nil {
+			// Try again later.
+			_, errUnmark := ordersStore.setItemStockDecremented(context.Background(), o.ID, i, false)
+			checkError(errUnmark)
+			return err
+		}
+		o.Items[i].StockDecremented = true
+		log.Printf("\tOrder %s, product %s stock decremented by %d", o.ID, item.ProductID, item.Quantity)
+	}
+	return nil
+}
+
+// Decrement stock for orders with items not decremented.
+func processPendingOrders(ctx context.Context) error {
+	collection := client.Database("zunka").Collection("zoomOrders")
+	filter := bson.D{{"items", bson.D{{"$elemMatch", bson.D{
+		{"productFound", true},
+		{"stockDecremented", false},
+		{"quantity", bson.D{{"$gt", 0}}},
+	}}}}}
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		o := order{}
+		if err = cur.Decode(&o); err != nil {
+			return err
+		}
+		if err = decrementOrderStock(ctx, &o); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// Get orders, newest first.
+func getOrders() (orders []order, err error) {
+	orders = []order{}
+	collection := client.Database("zunka").Collection("zoomOrders")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{"orderedAt", -1}})
+	findOptions.SetLimit(ORDERS_LIST_LIMIT)
+	cur, err := collection.Find(ctx, bson.D{}, findOptions)
+	if err != nil {
+		return orders, err
+	}
+	defer cur.Close(ctx)
+	err = cur.All(ctx, &orders)
+	return orders, err
+}
+
+// Get newest order time received by polling.
+func getOrdersSince() (time.Time, error) {
+	collection := client.Database("zunka").Collection("params")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var result struct {
+		Value time.Time `bson:"value"`
+	}
+	err := collection.FindOne(ctx, bson.M{"name": ORDERS_SINCE}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	return result.Value, err
+}
+
+// Save newest order time received by polling.
+func saveOrdersSince(since time.Time) {
+	collection := client.Database("zunka").Collection("params")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	filter := bson.M{"name": ORDERS_SINCE}
+	update := bson.M{
+		"$set": bson.M{"value": since},
+	}
+	_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	checkError(err)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// Orders and stock kept in memory.
+type memOrderStore struct {
+	stock         map[string]int // By product id.
+	orders        map[string]*order
+	failDecrement int // Next stock decrements that fail.
+	decrements    int
+}
+
+func newMemOrderStore(stock map[string]int) *memOrderStore {
+	return &memOrderStore{stock: stock, orders: map[string]*order{}}
+}
+
+func (s *memOrderStore) productsExist(ctx context.Context, productsID []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	for _, id := range productsID {
+		if _, ok := s.stock[id]; ok {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
+func (s *memOrderStore) insertOrder(ctx context.Context, o *order) (bool, error) {
+	if _, ok := s.orders[o.ID]; ok {
+		return false, nil
+	}
+	stored := *o
+	stored.Items = append([]orderItem{}, o.Items...)
+	s.orders[o.ID] = &stored
+	return true, nil
+}
+
+func (s *memOrderStore) setItemStockDecremented(ctx context.Context, orderID string, item int, decremented bool) (bool, error) {
+	o, ok := s.orders[orderID]
+	if !ok || o.Items[item].StockDecremented == decremented {
+		return false, nil
+	}
+	o.Items[item].StockDecremented = decremented
+	return true, nil
+}
+
+func (s *memOrderStore) decrementStock(ctx context.Context, productID string, quantity int) error {
+	if s.failDecrement > 0 {
+		s.failDecrement--
+		return errors.New("stock not decremented")
+	}
+	s.stock[productID] -= quantity
+	s.decrements++
+	return nil
+}
+
+// Use memory orders store and fake Zoom, restored at test end.
+func setOrdersTest(t *testing.T, store *memOrderStore) {
+	oldStore := ordersStore
+	ordersStore = store
+	ts := httptest.NewServer(newFakeZoom("").router())
+	oldHost, hostSet := os.LookupEnv("ZOOM_HOST")
+	os.Setenv("ZOOM_HOST", ts.URL)
+	t.Cleanup(func() {
+		ordersStore = oldStore
+		ts.Close()
+		if hostSet {
+			os.Setenv("ZOOM_HOST", oldHost)
+		} else {
+			os.Unsetenv("ZOOM_HOST")
+		}
+	})
+}
+
+// Create order at fake Zoom.
+func createFakeZoomOrder(t *testing.T, o interface{}) {
+	body, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Post(zoomAPIHost()+"/orders", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 201 {
+		t.Fatalf("create order status: %d", res.StatusCode)
+	}
+}
+
+func fakeOrder(id string, items ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"order_id":   id,
+		"status":     "approved",
+		"created_at": "2020-05-10T10:00:00",
+		"items":      items,
+	}
+}
+
+func fakeOrderItem(productID string, quantity int) map[string]interface{} {
+	return map[string]interface{}{"product_id": productID, "name": "Product " + productID, "quantity": quantity, "price": 10}
+}
+
+func TestReceiveOrdersIdempotent(t *testing.T) {
+	tests := []struct {
+		name           string
+		orders         []map[string]interface{}
+		receives       int // Times orders are received, like polling and webhook.
+		wantStock      map[string]int
+		wantDecrements int
+	}{
+		{
+			name:           "received once",
+			orders:         []map[string]interface{}{fakeOrder("o1", fakeOrderItem("p1", 2))},
+			receives:       1,
+			wantStock:      map[string]int{"p1": 8, "p2": 5},
+			wantDecrements: 1,
+		},
+		{
+			name:           "received again",
+			orders:         []map[string]interface{}{fakeOrder("o1", fakeOrderItem("p1", 2), fakeOrderItem("p2", 1))},
+			receives:       3,
+			wantStock:      map[string]int{"p1": 8, "p2": 4},
+			wantDecrements: 2,
+		},
+		{
+			name:           "product not found and no quantity",
+			orders:         []map[string]interface{}{fakeOrder("o1", fakeOrderItem("unknown", 1), fakeOrderItem("p1", 0))},
+			receives:       2,
+			wantStock:      map[string]int{"p1": 10, "p2": 5},
+			wantDecrements: 0,
+		},
+		{
+			name:           "many orders",
+			orders:         []map[string]interface{}{fakeOrder("o1", fakeOrderItem("p1", 1)), fakeOrder("o2", fakeOrderItem("p1", 3))},
+			receives:       2,
+			wantStock:      map[string]int{"p1": 6, "p2": 5},
+			wantDecrements: 2,
+		},
+	}
+	for _, tt := range tests {
+		store := newMemOrderStore(map[string]int{"p1": 10, "p2": 5})
+		setOrdersTest(t, store)
+		for _, o := range tt.orders {
+			createFakeZoomOrder(t, o)
+		}
+		for i := 0; i < tt.receives; i++ {
+			payloads, err := getZoomOrders(context.Background(), time.Time{})
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if _, err = receiveOrders(context.Background(), payloads, ORDER_SOURCE_POLLING); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		for id, want := range tt.wantStock {
+			if store.stock[id] != want {
+				t.Errorf("%s: stock %s = %d, want %d", tt.name, id, store.stock[id], want)
+			}
+		}
+		if store.decrements != tt.wantDecrements {
+			t.Errorf("%s: decrements = %d, want %d", tt.name, store.decrements, tt.wantDecrements)
+		}
+		if len(store.orders) != len(tt.orders) {
+			t.Errorf("%s: orders = %d, want %d", tt.name, len(store.orders), len(tt.orders))
+		}
+	}
+}
+
+func TestDecrementOrderStockRetry(t *testing.T) {
+	store := newMemOrderStore(map[string]int{"p1": 10})
+	setOrdersTest(t, store)
+	createFakeZoomOrder(t, fakeOrder("o1", fakeOrderItem("p1", 2)))
+	payloads, err := getZoomOrders(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stock not decremented, item is not marked.
+	store.failDecrement = 1
+	if _, err = receiveOrders(context.Background(), payloads, ORDER_SOURCE_WEBHOOK); err == nil {
+		t.Fatalf("receiveOrders() with stock failure, want error")
+	}
+	if store.stock["p1"] != 10 || store.orders["o1"].Items[0].StockDecremented {
+		t.Fatalf("stock = %d, decremented = %v, want 10 and false", store.stock["p1"], store.orders["o1"].Items[0].StockDecremented)
+	}
+
+	// Pending order processed many times.
+	for i := 0; i < 3; i++ {
+		o := *store.orders["o1"]
+		o.Items = append([]orderItem{}, o.Items...)
+		if err = decrementOrderStock(context.Background(), &o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Received again.
+	if _, err = receiveOrders(context.Background(), payloads, ORDER_SOURCE_POLLING); err != nil {
+		t.Fatal(err)
+	}
+	if store.stock["p1"] != 8 || store.decrements != 1 {
+		t.Errorf("stock = %d, decrements = %d, want 8 and 1", store.stock["p1"], store.decrements)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const TIME_TO_PUSH_ORDERS_STATUS_MIN = 1
+
+// Order status at Zunka, reported to Zoom in this sequence, or cancelled at any time.
+const (
+	ORDER_STATUS_APPROVED  = "approved"
+	ORDER_STATUS_INVOICED  = "invoiced"
+	ORDER_STATUS_SHIPPED   = "shipped"
+	ORDER_STATUS_DELIVERED = "delivered"
+	ORDER_STATUS_CANCELLED = "cancelled"
+)
+
+var orderStatusSequence = []string{
+	ORDER_STATUS_APPROVED,
+	ORDER_STATUS_INVOICED,
+	ORDER_STATUS_SHIPPED,
+	ORDER_STATUS_DELIVERED,
+}
+
+// Order invoice (NF-e).
+type orderInvoice struct {
+	Key      string    `bson:"key" json:"key"` // NF-e access key, 44 digits.
+	Number   string    `bson:"number" json:"number"`
+	Series   string    `bson:"series" json:"series"`
+	IssuedAt time.Time `bson:"issuedAt" json:"issuedAt"`
+}
+
+// Order shipment.
+type orderShipment struct {
+	Carrier      string    `bson:"carrier" json:"carrier"`
+	TrackingCode string    `bson:"trackingCode" json:"trackingCode"`
+	TrackingURL  string    `bson:"trackingURL" json:"trackingURL"`
+	ShippedAt    time.Time `bson:"shippedAt" json:"shippedAt"`
+}
+
+// Order status set by Zunka.
+type orderStatusChange struct {
+	Status      string         `json:"status"`
+	Invoice     *orderInvoice  `json:"invoice"`
+	Shipment    *orderShipment `json:"shipment"`
+	DeliveredAt time.Time      `json:"deliveredAt"`
+}
+
+// Order status sent to Zoom.
+type zoomOrderStatus struct {
+	Status      string             `json:"status"`
+	Invoice     *zoomOrderInvoice  `json:"invoice,omitempty"`
+	Tracking    *zoomOrderTracking `json:"tracking,omitempty"`
+	DeliveredAt string             `json:"delivered_at,omitempty"`
+}
+type zoomOrderInvoice struct {
+	Key      string `json:"key"`
+	Number   string `json:"number"`
+	Series   string `json:"series"`
+	IssuedAt string `json:"issued_at"`
+}
+type zoomOrderTracking struct {
+	Carrier   string `json:"carrier"`
+	Code      string `json:"code"`
+	Url       string `json:"url"`
+	ShippedAt string `json:"shipped_at"`
+}
+
+// Check if order status is valid.
+func validOrderStatus(status string) bool {
+	if status == ORDER_STATUS_CANCELLED {
+		return true
+	}
+	return orderStatusIndex(status) >= 0
+}
+
+// Order status position at sequence, -1 if not at sequence.
+func orderStatusIndex(status string) int {
+	for i, s := range orderStatusSequence {
+		if s == status {
+			return i
+		}
+	}
+	return -1
+}
+
+// Next status to send to Zoom, empty if nothing to send.
+func (o *order) nextZoomStatus() string {
+	if o.ZunkaStatus == "" || o.ZunkaStatus == o.ZoomStatusSent || o.ZoomStatusSent == ORDER_STATUS_CANCELLED {
+		return ""
+	}
+	if o.ZunkaStatus == ORDER_STATUS_CANCELLED {
+		return ORDER_STATUS_CANCELLED
+	}
+	// Zoom receive each transition, so skipped status are sent first.
+	next := orderStatusIndex(o.ZoomStatusSent) + 1
+	if next > orderStatusIndex(o.ZunkaStatus) {
+		return ""
+	}
+	return orderStatusSequence[next]
+}
+
+// Check order status change, invoice and shipment required by status must be at change or at stored order.
+func checkOrderStatusChange(o *order, change *orderStatusChange) error {
+	if !validOrderStatus(change.Status) {
+		return errors.New("Invalid status " + change.Status)
+	}
+	// Cancelled order status is final.
+	if o.ZunkaStatus == ORDER_STATUS_CANCELLED || o.ZoomStatusSent == ORDER_STATUS_CANCELLED {
+		return errors.New("Order cancelled")
+	}
+	// Same status is accepted to update invoice or shipment.
+	if change.Status != ORDER_STATUS_CANCELLED && orderStatusIndex(change.Status) < orderStatusIndex(o.ZunkaStatus) {
+		return errors.New("Status " + change.Status + " is before current status " + o.ZunkaStatus)
+	}
+	if change.Invoice != nil && (len(change.Invoice.Key) != 44 || change.Invoice.Number == "") {
+		return errors.New("Invoice must have a 44 digits key and a number")
+	}
+	if change.Shipment != nil && (change.Shipment.Carrier == "" || change.Shipment.TrackingCode == "") {
+		return errors.New("Shipment must have carrier and tracking code")
+	}
+	// Cancelled is not at sequence.
+	index := orderStatusIndex(change.Status)
+	if index >= orderStatusIndex(ORDER_STATUS_INVOICED) && change.Invoice == nil && o.Invoice == nil {
+		return errors.New("Status " + change.Status + " require invoice")
+	}
+	if index >= orderStatusIndex(ORDER_STATUS_SHIPPED) && change.Shipment == nil && o.Shipment == nil {
+		return errors.New("Status " + change.Status + " require shipment")
+	}
+	return nil
+}
+
+// Set order status at Zunka, sent to Zoom by push orders status job.
+func setOrderStatus(ctx context.Context, orderID string, change *orderStatusChange) error {
+	collection := client.Database("zunka").Collection("zoomOrders")
+	o := order{}
+	err := collection.FindOne(ctx, bson.D{{"_id", orderID}}).Decode(&o)
+	if err == mongo.ErrNoDocuments {
+		return errors.New("Order not found")
+	}
+	if err != nil {
+		return err
+	}
+	if err = checkOrderStatusChange(&o, change); err != nil {
+		return err
+	}
+	set := bson.D{
+		{"zunkaStatus", change.Status},
+		{"statusError", ""},
+		{"statusFailures", 0},
+		{"statusRetryAt", time.Time{}},
+		{"statusUpdatedAt", time.Now()},
+	}
+	if change.Invoice != nil {
+		set = append(set, bson.E{"invoice", change.Invoice})
+	}
+	if change.Shipment != nil {
+		set = append(set, bson.E{"shipment", change.Shipment})
+	}
+	if !change.DeliveredAt.IsZero() {
+		set = append(set, bson.E{"deliveredAt", change.DeliveredAt})
+	}
+	// Status checked against stored status, not changed meanwhile.
+	filter := bson.D{{"_id", orderID}, {"zunkaStatus", o.ZunkaStatus}}
+	if o.ZunkaStatus == "" {
+		filter = bson.D{{"_id", orderID}, {"zunkaStatus", bson.D{{"$in", bson.A{"", nil}}}}}
+	}
+	res, err := collection.UpdateOne(ctx, filter, bson.D{{"$set", set}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("Order status changed meanwhile, try again")
+	}
+	return nil
+}
+
+// Send order status transitions to Zoom.
+func pushOrdersStatus(ctx context.Context) error {
+	muxUpdateZoomProducts.Lock()
+	defer muxUpdateZoomProducts.Unlock()
+
+	collection := client.Database("zunka").Collection("zoomOrders")
+	filter := bson.D{
+		{"zunkaStatus", bson.D{{"$exists", true}, {"$ne", ""}}},
+		{"$expr", bson.D{{"$ne", bson.A{"$zunkaStatus", "$zoomStatusSent"}}}},
+		{"zoomStatusSent", bson.D{{"$ne", ORDER_STATUS_CANCELLED}}},
+	}
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	orders := []order{}
+	err = cur.All(ctx, &orders)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range orders {
+		o := &orders[i]
+		// Waiting ticket.
+		if _, ok := zoomTickets[o.StatusTicketID]; ok && o.StatusTicketID != "" {
+			continue
+		}
+		// Backoff from last error.
+		if time.Now().Before(o.StatusRetryAt) {
+			continue
+		}
+		status := o.nextZoomStatus()
+		if status == "" {
+			continue
+		}
+		ticketID, err := sendZoomOrderStatus(ctx, o, status)
+		if err != nil {
+			failed++
+			log.Printf("[warn] Could not send order %s status %s to Zoom. %v", o.ID, status, err)
+			setOrderStatusError(bson.D{{"_id", o.ID}}, o.StatusFailures+1, err.Error())
+			continue
+		}
+		log.Printf(":: Order %s status %s sent to Zoom, ticket %s", o.ID, status, ticketID)
+		_, err = collection.UpdateOne(ctx, bson.D{{"_id", o.ID}}, bson.D{{"$set", bson.D{
+			{"statusTicketID", ticketID},
+			{"statusTicketStatus", status},
+			{"statusError", ""},
+		}}})
+		checkError(err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Could not send %d order(s) status to Zoom", failed)
+	}
+	return nil
+}
+
+// Send order status to Zoom, ticket is tracked by check tickets.
+func sendZoomOrderStatus(ctx context.Context, o *order, status string) (ticketID string, err error) {
+	body := zoomOrderStatus{Status: status}
+	switch status {
+	case ORDER_STATUS_INVOICED:
+		if o.Invoice == nil {
+			return "", errors.New("Invoiced order without invoice")
+		}
+		body.Invoice = &zoomOrderInvoice{
+			Key:      o.Invoice.Key,
+			Number:   o.Invoice.Number,
+			Series:   o.Invoice.Series,
+			IssuedAt: zoomTimeString(o.Invoice.IssuedAt),
+		}
+	case ORDER_STATUS_SHIPPED:
+		if o.Shipment == nil {
+			return "", errors.New("Shipped order without shipment")
+		}
+		body.Tracking = &zoomOrderTracking{
+			Carrier:   o.Shipment.Carrier,
+			Code:      o.Shipment.TrackingCode,
+			Url:       o.Shipment.TrackingURL,
+			ShippedAt: zoomTimeString(o.Shipment.ShippedAt),
+		}
+	case ORDER_STATUS_DELIVERED:
+		body.DeliveredAt = zoomTimeString(o.DeliveredAt)
+	}
+
+	resBody, err := zoomRequest(ctx, "PUT", "/orders/"+url.PathEscape(o.ID)+"/status", body)
+	if err != nil {
+		return "", err
+	}
+	ticket := zoomTicket{}
+	err = json.Unmarshal(resBody, &ticket)
+	if err != nil {
+		return "", err
+	}
+	if ticket.ID == "" {
+		return "", errors.New("No ticket received: " + string(resBody))
+	}
+	ticket.OrderID = o.ID
+	ticket.OrderStatus = status
+	ticket.OrderStatusFailures = o.StatusFailures
+	addZoomTicket(&ticket)
+	return ticket.ID, nil
+}
+
+// Order status ticket finished, receipt is nil if ticket was given up.
+func orderStatusTicketFinished(ticket *zoomTicket, receipt *zoomReceipt) {
+	collection := client.Database("zunka").Collection("zoomOrders")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	filter := bson.D{{"_id", ticket.OrderID}, {"statusTicketID", ticket.ID}}
+
+	statusError := ""
+	if receipt == nil {
+		statusError = "Ticket given up"
+	} else {
+		for _, result := range receipt.Results {
+			if result.Status != 200 && result.Status != 201 {
+				statusError = fmt.Sprintf("Status %d, %s", result.Status, result.Message)
+			}
+		}
+	}
+	if statusError != "" {
+		log.Printf("[warn] Order %s status %s not received by Zoom, will be sent again. %s", ticket.OrderID, ticket.OrderStatus, statusError)
+		setOrderStatusError(filter, ticket.OrderStatusFailures+1, statusError)
+		return
+	}
+	log.Printf("\tOrder %s status %s received by Zoom", ticket.OrderID, ticket.OrderStatus)
+	set := bson.D{
+		{"statusTicketID", ""},
+		{"statusError", ""},
+		{"statusFailures", 0},
+		{"statusRetryAt", time.Time{}},
+		{"zoomStatusSent", ticket.OrderStatus},
+		{"zoomStatusSentAt", time.Now()},
+	}
+	_, err := collection.UpdateOne(ctx, filter, bson.D{{"$set", set}})
+	checkError(err)
+}
+
+// Save order status error, status is sent again after backoff delay.
+func setOrderStatusError(filter bson.D, failures int, statusError string) {
+	collection := client.Database("zunka").Collection("zoomOrders")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := collection.UpdateOne(ctx, filter, bson.D{{"$set", bson.D{
+		{"statusTicketID", ""},
+		{"statusError", statusError},
+		{"statusFailures", failures},
+		{"statusRetryAt", time.Now().Add(retryDelay(0, failures))},
+	}}})
+	checkError(err)
+}
+
+// Time in Zoom format.
+func zoomTimeString(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.In(brLocation).Format("2006-01-02T15:04:05")
+}
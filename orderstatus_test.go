@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckOrderStatusChange(t *testing.T) {
+	invoice := &orderInvoice{Key: strings.Repeat("1", 44), Number: "10"}
+	shipment := &orderShipment{Carrier: "Correios", TrackingCode: "BR1"}
+
+	tests := []struct {
+		name    string
+		stored  order
+		change  orderStatusChange
+		wantErr bool
+	}{
+		{"invalid status", order{}, orderStatusChange{Status: "lost"}, true},
+		{"approved", order{}, orderStatusChange{Status: ORDER_STATUS_APPROVED}, false},
+		{"cancelled", order{}, orderStatusChange{Status: ORDER_STATUS_CANCELLED}, false},
+		{"invoiced without invoice", order{}, orderStatusChange{Status: ORDER_STATUS_INVOICED}, true},
+		{"invoiced with invoice", order{}, orderStatusChange{Status: ORDER_STATUS_INVOICED, Invoice: invoice}, false},
+		{"invalid invoice", order{}, orderStatusChange{Status: ORDER_STATUS_INVOICED, Invoice: &orderInvoice{Key: "1", Number: "10"}}, true},
+		{"shipped with stored invoice", order{Invoice: invoice}, orderStatusChange{Status: ORDER_STATUS_SHIPPED, Shipment: shipment}, false},
+		{"shipped without shipment", order{Invoice: invoice}, orderStatusChange{Status: ORDER_STATUS_SHIPPED}, true},
+		{"shipped without invoice", order{}, orderStatusChange{Status: ORDER_STATUS_SHIPPED, Shipment: shipment}, true},
+		{"invalid shipment", order{Invoice: invoice}, orderStatusChange{Status: ORDER_STATUS_SHIPPED, Shipment: &orderShipment{Carrier: "Correios"}}, true},
+		{"delivered with stored data", order{Invoice: invoice, Shipment: shipment}, orderStatusChange{Status: ORDER_STATUS_DELIVERED}, false},
+		{"same status", order{ZunkaStatus: ORDER_STATUS_INVOICED, Invoice: invoice}, orderStatusChange{Status: ORDER_STATUS_INVOICED, Invoice: invoice}, false},
+		{"backward", order{ZunkaStatus: ORDER_STATUS_SHIPPED, Invoice: invoice, Shipment: shipment}, orderStatusChange{Status: ORDER_STATUS_APPROVED}, true},
+		{"cancelled after shipped", order{ZunkaStatus: ORDER_STATUS_SHIPPED, Invoice: invoice, Shipment: shipment}, orderStatusChange{Status: ORDER_STATUS_CANCELLED}, false},
+		{"after cancelled", order{ZunkaStatus: ORDER_STATUS_CANCELLED}, orderStatusChange{Status: ORDER_STATUS_APPROVED}, true},
+		{"cancelled again", order{ZunkaStatus: ORDER_STATUS_CANCELLED}, orderStatusChange{Status: ORDER_STATUS_CANCELLED}, true},
+		{"after cancelled sent", order{ZoomStatusSent: ORDER_STATUS_CANCELLED}, orderStatusChange{Status: ORDER_STATUS_APPROVED}, true},
+	}
+	for _, tt := range tests {
+		err := checkOrderStatusChange(&tt.stored, &tt.change)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkOrderStatusChange() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNextZoomStatus(t *testing.T) {
+	tests := []struct {
+		zunkaStatus string
+		sent        string
+		want        string
+	}{
+		{"", "", ""},
+		{ORDER_STATUS_APPROVED, "", ORDER_STATUS_APPROVED},
+		{ORDER_STATUS_APPROVED, ORDER_STATUS_APPROVED, ""},
+		{ORDER_STATUS_SHIPPED, ORDER_STATUS_APPROVED, ORDER_STATUS_INVOICED},
+		{ORDER_STATUS_CANCELLED, ORDER_STATUS_INVOICED, ORDER_STATUS_CANCELLED},
+		{ORDER_STATUS_DELIVERED, ORDER_STATUS_CANCELLED, ""},
+	}
+	for _, tt := range tests {
+		o := order{ZunkaStatus: tt.zunkaStatus, ZoomStatusSent: tt.sent}
+		if got := o.nextZoomStatus(); got != tt.want {
+			t.Errorf("nextZoomStatus(%q, sent %q) = %q, want %q", tt.zunkaStatus, tt.sent, got, tt.want)
+		}
+	}
+}
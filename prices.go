@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OFFERS_EAN_BY_REQUEST        = 100
+	PRICE_HISTORY_LIMIT          = 100
+	PRICE_HISTORY_RETENTION_DAYS = 180 // Older checks are removed by TTL index.
+)
+
+// Competitor offer at Zoom.
+type competitorOffer struct {
+	EAN    string  `json:"ean"`
+	Seller string  `json:"seller"`
+	Price  float64 `json:"price"`
+}
+
+// Competitor offers source.
+type offersSource interface {
+	getOffers(ctx context.Context, eans []string) ([]competitorOffer, error)
+}
+
+// Offers from json file, to test without a real source.
+type fileOffersSource struct {
+	path string
+}
+
+// Offers from url, requested with ean query param, comma separated.
+type urlOffersSource struct {
+	url string
+}
+
+// Product price checked against competitor offers.
+type priceCheck struct {
+	ProductID      string    `bson:"productID" json:"productID"`
+	Name           string    `bson:"name" json:"name"`
+	EAN            string    `bson:"ean" json:"ean"`
+	Price          float64   `bson:"price" json:"price"` // Zoom price.
+	ZunkaPrice     float64   `bson:"zunkaPrice" json:"zunkaPrice"`
+	LowestPrice    float64   `bson:"lowestPrice" json:"lowestPrice"`
+	LowestSeller   string    `bson:"lowestSeller" json:"lowestSeller"`
+	Offers         int       `bson:"offers" json:"offers"`
+	AbovePercent   float64   `bson:"abovePercent" json:"abovePercent"` // Price above lowest offer.
+	SuggestedPrice float64   `bson:"suggestedPrice" json:"suggestedPrice"`
+	CheckedAt      time.Time `bson:"checkedAt" json:"checkedAt"`
+}
+
+// Offers source from config, nil if not configured.
+func newOffersSource(source string) offersSource {
+	if source == "" {
+		return nil
+	}
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return &urlOffersSource{url: source}
+	}
+	return &fileOffersSource{path: source}
+}
+
+// Get offers from file, all offers are read.
+func (s *fileOffersSource) getOffers(ctx context.Context, eans []string) ([]competitorOffer, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	offers := []competitorOffer{}
+	err = json.Unmarshal(data, &offers)
+	return offers, err
+}
+
+// Get offers from url.
+func (s *urlOffersSource) getOffers(ctx context.Context, eans []string) ([]competitorOffer, error) {
+	offers := []competitorOffer{}
+	for i := 0; i < len(eans); i += OFFERS_EAN_BY_REQUEST {
+		end := i + OFFERS_EAN_BY_REQUEST
+		if end > len(eans) {
+			end = len(eans)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", s.url+"?ean="+url.QueryEscape(strings.Join(eans[i:end], ",")), nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resBody, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != 200 {
+			return nil, fmt.Errorf("Getting offers, status: %v, body: %s", res.StatusCode, string(resBody))
+		}
+		page := []competitorOffer{}
+		if err = json.Unmarshal(resBody, &page); err != nil {
+			return nil, err
+		}
+		offers = append(offers, page...)
+	}
+	return offers, nil
+}
+
+// Check Zoom prices against competitor offers and save price history.
+func checkPrices(ctx context.Context) error {
+	source := newOffersSource(config.Pricing.OffersSource)
+	if source == nil {
+		return errors.New("No offers source")
+	}
+	cZoomDb := make(chan productZoomAOk)
+	go getAllZunkaProducts(ctx, cZoomDb)
+	prodZoomDBAOk := <-cZoomDb
+	if !prodZoomDBAOk.Ok {
+		return errors.New("Could not get Zunka products.")
+	}
+	// Published products with ean.
+	products := map[string][]*productZoom{}
+	eans := []string{}
+	for i := range *prodZoomDBAOk.Products {
+		p := &(*prodZoomDBAOk.Products)[i]
+		if p.EAN == "" || !p.PublishState.upsert() {
+			continue
+		}
+		if _, ok := products[p.EAN]; !ok {
+			eans = append(eans, p.EAN)
+		}
+		products[p.EAN] = append(products[p.EAN], p)
+	}
+	if len(eans) == 0 {
+		return nil
+	}
+	offers, err := source.getOffers(ctx, eans)
+	if err != nil {
+		return err
+	}
+	offersByEAN := map[string][]competitorOffer{}
+	for _, offer := range offers {
+		if offer.Price <= 0 || strings.EqualFold(offer.Seller, config.Pricing.Seller) {
+			continue
+		}
+		offersByEAN[offer.EAN] = append(offersByEAN[offer.EAN], offer)
+	}
+
+	now := time.Now()
+	checks := []interface{}{}
+	above := 0
+	for _, ean := range eans {
+		eanOffers, ok := offersByEAN[ean]
+		if !ok {
+			continue
+		}
+		for _, p := range products[ean] {
+			check := newPriceCheck(p, eanOffers, now)
+			// Counted even if no suggested price, because of margin floor.
+			if check.above() {
+				above++
+			}
+			checks = append(checks, check)
+		}
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+	collection := client.Database("zunka").Collection("zoomPriceHistory")
+	_, err = collection.InsertMany(ctx, checks)
+	if err != nil {
+		return err
+	}
+	log.Printf(":: Prices checked, products with offers: %d, above lowest offer: %d", len(checks), above)
+	return nil
+}
+
+// Compare product price with offers, suggested price only for price above lowest offer by more than configured.
+func newPriceCheck(p *productZoom, offers []competitorOffer, checkedAt time.Time) *priceCheck {
+	check := &priceCheck{
+		ProductID:  p.ID,
+		Name:       p.Name,
+		EAN:        p.EAN,
+		Price:      p.Price,
+		ZunkaPrice: p.ZunkaPrice,
+		Offers:     len(offers),
+		CheckedAt:  checkedAt,
+	}
+	for _, offer := range offers {
+		if check.LowestPrice == 0 || offer.Price < check.LowestPrice {
+			check.LowestPrice = offer.Price
+			check.LowestSeller = offer.Seller
+		}
+	}
+	check.AbovePercent = keepTowDigits((p.Price/check.LowestPrice - 1) * 100)
+	if !check.above() {
+		return check
+	}
+	// Margin floor, over Zunka price with Zoom charge.
+	suggested := check.LowestPrice - config.Pricing.Undercut
+	floorCents := p.ZunkaPrice * AMOUNT_CHARGED_BY_ZOOM * (1 + config.Pricing.MinMarkupPercent/100) * 100
+	// Rounded before ceil, so float error not add a cent.
+	floor := math.Ceil(math.Round(floorCents*1000)/1000) / 100
+	if suggested < floor {
+		suggested = floor
+	}
+	suggested = math.Round(suggested*100) / 100
+	if suggested < p.Price {
+		check.SuggestedPrice = suggested
+	}
+	return check
+}
+
+// Price above lowest offer by more than configured.
+func (c *priceCheck) above() bool {
+	return c.AbovePercent > config.Pricing.AbovePercent
+}
+
+// Index to get product history and last checks, and TTL index to remove old checks.
+func createPriceHistoryIndexes() {
+	collection := client.Database("zunka").Collection("zoomPriceHistory")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{"productID", 1}, {"checkedAt", -1}},
+		},
+		{
+			Keys:    bson.D{{"checkedAt", 1}},
+			Options: options.Index().SetExpireAfterSeconds(PRICE_HISTORY_RETENTION_DAYS * 24 * 60 * 60),
+		},
+	})
+	checkError(err)
+}
+
+// Products with Zoom price above lowest offer by more than configured, from last check of each product.
+func getPriceReport(ctx context.Context) ([]priceCheck, error) {
+	pipeline := bson.A{
+		bson.D{{"$sort", bson.D{{"productID", 1}, {"checkedAt", -1}}}},
+		bson.D{{"$group", bson.D{
+			{"_id", "$productID"},
+			{"last", bson.D{{"$first", "$$ROOT"}}},
+		}}},
+		bson.D{{"$replaceRoot", bson.D{{"newRoot", "$last"}}}},
+		bson.D{{"$match", bson.D{{"abovePercent", bson.D{{"$gt", config.Pricing.AbovePercent}}}}}},
+		bson.D{{"$sort", bson.D{{"abovePercent", -1}}}},
+	}
+	collection := client.Database("zunka").Collection("zoomPriceHistory")
+	cur, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	report := []priceCheck{}
+	err = cur.All(ctx, &report)
+	return report, err
+}
+
+// Product price history, newest first.
+func getPriceHistory(ctx context.Context, productID string) ([]priceCheck, error) {
+	collection := client.Database("zunka").Collection("zoomPriceHistory")
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{"checkedAt", -1}})
+	findOptions.SetLimit(PRICE_HISTORY_LIMIT)
+	cur, err := collection.Find(ctx, bson.D{{"productID", productID}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	history := []priceCheck{}
+	err = cur.All(ctx, &history)
+	return history, err
+}
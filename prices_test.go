@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewPriceCheck(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config = defaultConfig()
+	config.Pricing.AbovePercent = 5
+	config.Pricing.Undercut = 0.01
+
+	tests := []struct {
+		name          string
+		price         float64 // Zoom price.
+		zunkaPrice    float64
+		minMarkup     float64
+		offers        []float64
+		wantLowest    float64
+		wantSuggested float64
+		wantAbove     bool
+	}{
+		{"not above", 112, 100, 0, []float64{110, 120}, 110, 0, false},
+		{"undercut", 130, 100, 0, []float64{120, 115}, 115, 114.99, true},
+		{"floor with Zoom charge", 130, 100, 0, []float64{105}, 105, 112, true},
+		{"floor with markup", 130, 100, 5, []float64{110}, 110, 117.6, true},
+		// Above lowest offer, but not suggested.
+		{"floor above price", 112, 100, 0, []float64{100}, 100, 0, true},
+	}
+	for _, tt := range tests {
+		config.Pricing.MinMarkupPercent = tt.minMarkup
+		p := &productZoom{ID: "p1", Price: tt.price, ZunkaPrice: tt.zunkaPrice}
+		offers := []competitorOffer{}
+		for _, price := range tt.offers {
+			offers = append(offers, competitorOffer{EAN: "1", Seller: "other", Price: price})
+		}
+		check := newPriceCheck(p, offers, time.Now())
+		if check.LowestPrice != tt.wantLowest {
+			t.Errorf("%s: lowest price = %v, want %v", tt.name, check.LowestPrice, tt.wantLowest)
+		}
+		if check.SuggestedPrice != tt.wantSuggested {
+			t.Errorf("%s: suggested price = %v, want %v", tt.name, check.SuggestedPrice, tt.wantSuggested)
+		}
+		if check.above() != tt.wantAbove {
+			t.Errorf("%s: above() = %v, want %v", tt.name, check.above(), tt.wantAbove)
+		}
+	}
+}
@@ -19,13 +19,14 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
 	ZOOM_TICKET_DEADLINE_MIN        = 30
 	TIME_TO_CHECK_PRODUCTS_MIN_S    = 1
-	TIME_TO_CHECK_PRODUCTS_MIN      = 5
+	TIME_TO_CHECK_PRODUCTS_MIN      = 1
 	TIME_TO_CHECK_CONCISTENCY_MIN_S = 3
 	TIME_TO_CHECK_CONCISTENCY_MIN   = 3
 	TIME_TO_CHECK_TICKETS_MIN_S     = 1
@@ -34,7 +35,6 @@ const (
 )
 
 var muxUpdateZoomProducts sync.Mutex
-var checkProductsTimer, checkConsistencyTimer, checkTicketsTimer *time.Timer
 
 type productZunka struct {
 	ObjectID      primitive.ObjectID `bson:"_id,omitempty"`
@@ -52,8 +52,46 @@ type productZunka struct {
 	Commercialize bool               `bson:"storeProductCommercialize"`
 	MarketZoom    bool               `bson:"marketZoom"`
 	Images        []string           `bson:"images"`
+	MainImage     string             `bson:"mainImage"` // Image file used as main image at Zoom.
+	DealerName    string             `bson:"dealerName"`
 	UpdatedAt     time.Time          `bson:"updatedAt"`
 	DeletedAt     time.Time          `bson:"deletedAt"`
+	// Zoom overrides.
+	ZoomFreeShipping *bool `bson:"zoomFreeShipping"`
+	ZoomCrossDocking *int  `bson:"zoomCrossDocking"` // Days.
+	ZoomStockBuffer  *int  `bson:"zoomStockBuffer"`
+	ZoomStatus       struct {
+		PayloadHash  string `bson:"payloadHash"`  // Last payload successfully sent to Zoom.
+		RejectedHash string `bson:"rejectedHash"` // Last payload rejected by Zoom.
+	} `bson:"zoomStatus"`
+}
+
+// Zunka product fields used to create Zoom product.
+var zunkaProductProjection = bson.D{
+	{"_id", true},
+	{"storeProductTitle", true},
+	{"storeProductCategory", true},
+	{"storeProductDetail", true},
+	{"storeProductTechnicalInformation", true}, // To get EAN if not have EAN.
+	{"storeProductLength", true},
+	{"storeProductHeight", true},
+	{"storeProductWidth", true},
+	{"storeProductWeight", true},
+	{"storeProductCommercialize", true},
+	{"storeProductPrice", true},
+	{"storeProductQtd", true},
+	{"ean", true},
+	{"marketZoom", true},
+	{"images", true},
+	{"mainImage", true},
+	{"dealerName", true},
+	{"zoomFreeShipping", true},
+	{"zoomCrossDocking", true},
+	{"zoomStockBuffer", true},
+	{"zoomStatus.payloadHash", true},
+	{"zoomStatus.rejectedHash", true},
+	{"updatedAt", true},
+	{"deletedAt", true},
 }
 
 type urlImageZoom struct {
@@ -93,61 +131,78 @@ type productZoom struct {
 	UpdatedAt    time.Time      `json:"-"`
 	DeletedAt    time.Time      `json:"-"`
 	NeverExisted bool           `json:"-"`
+	PublishState publishState   `json:"-"`
+	// Zunka product problems, shown at Zunka site.
+	ValidationErrors []string `json:"-"`
+	// Hash from last payload successfully sent to Zoom.
+	PublishedHash string `json:"-"`
+	// Hash from last payload rejected by Zoom.
+	RejectedHash string `json:"-"`
+	// Zunka price and quantity, before Zoom rules.
+	ZunkaPrice    float64 `json:"-"`
+	ZunkaQuantity int     `json:"-"`
+	// Zunka flags, MarketZoom is set only for commercialized products.
+	ZunkaMarketZoom    bool `json:"-"`
+	ZunkaCommercialize bool `json:"-"`
 }
 
 // Check if product received from zoom is equal.
 func (p *productZoom) Equal(pr *productZoomR) bool {
-	// log.Println("Inside equal")
-	// Product not exist or not active at zoom but exist and marked at zunka.
-	if (pr.ID == "" || !pr.Active) && p.DeletedAt.IsZero() && p.MarketZoom {
-		log.Printf("Different status (inactive at Zoom and active at Zunka). Zunka ID: %+v, Zunka DeletedAt.IsZero(): %+v, Zunka MarketZoom: %+v, Zoom ID: %+v, Zoom Active: %+v\n", p.ID, p.DeletedAt.IsZero(), p.MarketZoom, pr.ID, pr.Active)
+	diff := p.Diff(pr)
+	if diff != "" {
+		log.Printf("%s. Product ID: %v\n", diff, p.ID)
 		return false
 	}
-	// Product active at zoom and deleted at zunka or not marked at zunka.
-	if pr.Active && (!p.DeletedAt.IsZero() || !p.MarketZoom) {
-		log.Printf("Different status (active at Zoom and inactive at Zunka). Zunka ID: %+v, Zunka DeletedAt.IsZero(): %+v, Zunka MarketZoom: %+v, Zoom ID: %+v, Zoom Active: %+v\n", p.ID, p.DeletedAt.IsZero(), p.MarketZoom, pr.ID, pr.Active)
-		return false
+	// log.Println("Is equal")
+	return true
+}
+
+// Difference from product received from zoom, empty if equal.
+func (p *productZoom) Diff(pr *productZoomR) string {
+	// log.Println("Inside equal")
+	// Payload rejected by Zoom, not sent again until it changes.
+	if p.PublishState.upsert() && p.RejectedHash != "" && payloadHash(p) == p.RejectedHash {
+		return ""
+	}
+	// Product not exist or not active at zoom but must exist at zoom.
+	if (pr.ID == "" || !pr.Active) && p.PublishState.upsert() {
+		return fmt.Sprintf("Different status (inactive at Zoom and active at Zunka). Zunka publish state: %v, Zoom ID: %+v, Zoom Active: %+v", p.PublishState, pr.ID, pr.Active)
+	}
+	// Product active at zoom and must not exist at zoom.
+	if pr.Active && p.PublishState.remove() {
+		return fmt.Sprintf("Different status (active at Zoom and inactive at Zunka). Zunka publish state: %v, Zoom ID: %+v, Zoom Active: %+v", p.PublishState, pr.ID, pr.Active)
 	}
 	// ID.
 	if pr.ID != p.ID {
-		log.Printf("Different ID. Zunka ID: %+v, Zoom ID: %+v\n", p.ID, pr.ID)
-		return false
+		return fmt.Sprintf("Different ID. Zoom ID: %+v", pr.ID)
 	}
 	// Free shipping.
 	if pr.FreeShipping != p.FreeShipping {
-		log.Printf("Different free shipping. Product ID: %v, Zunka: %+v, Zoom: %+v\n", p.ID, p.FreeShipping, pr.FreeShipping)
-		return false
+		return fmt.Sprintf("Different free shipping. Zunka: %+v, Zoom: %+v", p.FreeShipping, pr.FreeShipping)
 	}
 	// Price - can have a little difference.
 	priceDiff := math.Abs(p.Price - pr.Price)
 	if priceDiff > 0.10 {
-		// log.Println("Inside price")
 		// log.Printf("pr.Price: %v", pr.Price)
-		// log.Printf("priceWithCharge: %v", priceWithCharge)
 		// log.Printf("priceDiff: %v", keepTowDigits(priceDiff))
-		log.Printf("Different price. Product ID %+v, Zunka with charge: %+v, Zoom: %+v, Diff: %+v\n", p.ID, p.Price, pr.Price, keepTowDigits(priceDiff))
-		return false
+		return fmt.Sprintf("Different price. Zunka with charge: %+v, Zoom: %+v, Diff: %+v", p.Price, pr.Price, keepTowDigits(priceDiff))
 	}
 	// Quantity.
 	if pr.Quantity != p.Quantity {
-		log.Printf("Different quantity. Product ID: %+v, Zunka: %+v, Zoom: %+v\n", p.ID, p.Quantity, pr.Quantity)
-		return false
+		return fmt.Sprintf("Different quantity. Zunka: %+v, Zoom: %+v", p.Quantity, pr.Quantity)
 	}
 	// Url.
 	if pr.Url != p.Url {
-		log.Printf("Different Url. Product ID %+v, Zunka: %+v, Zoom: %+v\n", p.ID, p.Url, pr.Url)
-		return false
+		return fmt.Sprintf("Different Url. Zunka: %+v, Zoom: %+v", p.Url, pr.Url)
 	}
-	// Deleted.
-	// Market Zoom.
-	if (p.DeletedAt.IsZero() && p.MarketZoom) != pr.Active {
-		// log.Printf("Different. Product ID %+v, Zunka DeletedAt: %+v, Zoom Active: %+v\n", p.ID, p.DeletedAt.IsZero(), pr.Active)
-		log.Printf("Different. Product ID %+v, Zunka DeletedAt: %+v, Zoom Active: %+v\n", p.ID, p.DeletedAt.IsZero(), pr.Active)
-		return false
+	// Fields not received from Zoom, like description, images, dimensions and EAN.
+	if p.PublishState.upsert() {
+		hash := payloadHash(p)
+		if hash != p.PublishedHash {
+			return fmt.Sprintf("Different payload hash. current: %+v, published: %+v", hash, p.PublishedHash)
+		}
 	}
-
-	// log.Println("Is equal")
-	return true
+	return ""
 }
 
 // Specific for receive product from Zoom.
@@ -186,7 +241,12 @@ type productZoomRAOk struct {
 	Ok       bool
 }
 type productZoomAOk struct {
-	Products *[]productZoom
+	Products  *[]productZoom
+	SkippedID []string // Products that could not be decoded.
+	Ok        bool
+}
+type zoomTicketIDOk struct {
+	TicketID string // Empty if nothing was sent.
 	Ok       bool
 }
 
@@ -217,6 +277,9 @@ type zoomTime struct {
 func (t *zoomTime) UnmarshalJSON(j []byte) error {
 	s := string(j)
 	s = strings.Trim(s, `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
 	newTime, err := time.Parse("2006-01-02T15:04:05", s)
 	if err != nil {
 		return err
@@ -227,11 +290,17 @@ func (t *zoomTime) UnmarshalJSON(j []byte) error {
 
 // To get result of product insertion or edit.
 type zoomTicket struct {
-	ID         string             `json:"ticket"`
+	ID         string             `json:"ticket" bson:"_id"`
 	Results    []zoomTicketResult `json:"results"`
 	ReceivedAt time.Time
 	TickCount  int // Number of ticks before get finish from zoom server.
 	ProductsID []string
+	// Hash from payload sent, by product id.
+	PayloadHashes map[string]string
+	// Order status sent, for order tickets.
+	OrderID             string
+	OrderStatus         string
+	OrderStatusFailures int
 }
 type zoomTicketResult struct {
 	ProductID string `json:"product_id"`
@@ -239,42 +308,95 @@ type zoomTicketResult struct {
 	Message   string `json:"message"`
 }
 
-// Tickets to check.
+// Tickets to check, saved into db so it is checked by next leader.
 var zoomTickets map[string]*zoomTicket
 
+// Add ticket to check.
+func addZoomTicket(ticket *zoomTicket) {
+	if ticket.ReceivedAt.IsZero() {
+		ticket.ReceivedAt = time.Now()
+	}
+	zoomTickets[ticket.ID] = ticket
+	collection := client.Database("zunka").Collection("zoomTickets")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": ticket.ID}, ticket, options.Replace().SetUpsert(true))
+	checkError(err)
+}
+
+// Remove checked ticket.
+func removeZoomTicket(ticketID string) {
+	delete(zoomTickets, ticketID)
+	collection := client.Database("zunka").Collection("zoomTickets")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": ticketID})
+	checkError(err)
+}
+
+// Load tickets to check, sent by this or previous leader.
+func loadZoomTickets() error {
+	collection := client.Database("zunka").Collection("zoomTickets")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cur, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	tickets := []zoomTicket{}
+	if err = cur.All(ctx, &tickets); err != nil {
+		return err
+	}
+	zoomTickets = map[string]*zoomTicket{}
+	for i := range tickets {
+		zoomTickets[tickets[i].ID] = &tickets[i]
+	}
+	if len(zoomTickets) > 0 {
+		log.Printf("Tickets to check: %d", len(zoomTickets))
+	}
+	return nil
+}
+
 // Check consistency.
-func checkConsistency() {
+func checkConsistency(ctx context.Context) error {
 	// log.Printf(":: Teste 1")
 	muxUpdateZoomProducts.Lock()
 	defer muxUpdateZoomProducts.Unlock()
 
 	if len(zoomTickets) > 0 {
 		log.Printf(":: Will not checking consistency, waiting to finish %d ticket(s).", len(zoomTickets))
-		checkConsistencyTimer = time.AfterFunc(time.Minute*TIME_TO_CHECK_CONCISTENCY_MIN, checkConsistency)
-		return
+		return nil
 	}
 	log.Println(":: Checking consistency...")
 
 	cZoomR := make(chan productZoomRAOk)
 	cZoomDb := make(chan productZoomAOk)
 
-	go getZoomProducts(cZoomR)
-	go getAllZunkaProducts(cZoomDb)
+	go getZoomProducts(ctx, cZoomR)
+	go getAllZunkaProducts(ctx, cZoomDb)
 
 	prodZoomDBAOk, prodZoomRAOK := <-cZoomDb, <-cZoomR
 
 	if prodZoomDBAOk.Ok && prodZoomRAOK.Ok {
+		// Zoom status at Zunka products.
+		updateZunkaProductsZoomStatus(*prodZoomDBAOk.Products, *prodZoomRAOK.Products)
+
 		// log.Printf("\tZunka products count: %v", len(*prodZoomDBAOk.Products))
 		// log.Printf("\tZoom Products count: %v", len(*prodZoomRAOK.Products))
 
 		productsToUpdate := []productZoom{}
 		productsToRemove := []productZoom{}
 
+		// Products that could not be decoded exist at Zunka, so they are not removed.
+		skippedID := map[string]bool{}
+		for _, id := range prodZoomDBAOk.SkippedID {
+			skippedID[id] = true
+		}
+
 		// Check if zoom have all products.
 		for _, prodDB := range *prodZoomDBAOk.Products {
-			// Product deleted or not marked to market Zoom.
-			// if !prodDB.DeletedAt.IsZero() || !prodDB.MarketZoom || prodDB.Quantity == 0 {
-			if !prodDB.DeletedAt.IsZero() || !prodDB.MarketZoom {
+			// Product must not exist at Zoom.
+			if prodDB.PublishState.remove() {
 				continue
 			}
 			// Product exist.
@@ -295,19 +417,21 @@ func checkConsistency() {
 		// Check if product was deleted  or not marked to Zoom market on zunka server.
 		for _, prodR := range *prodZoomRAOK.Products {
 			// Product considered as removed on zoom server when active is false.
-			if !prodR.Active {
+			if !prodR.Active || skippedID[prodR.ID] {
 				continue
 			}
 			productFound := false
 			for _, prodDB := range *prodZoomDBAOk.Products {
 				// Product exist on db.
 				if prodDB.ID == prodR.ID {
-					// Product deleted or not marked to market Zoom.
-					if !prodDB.DeletedAt.IsZero() || !prodDB.MarketZoom {
+					// Product must not exist at Zoom.
+					if prodDB.PublishState.remove() {
 						productsToRemove = append(productsToRemove, productZoom{
-							ID:         prodDB.ID,
-							DeletedAt:  prodDB.DeletedAt,
-							MarketZoom: prodDB.MarketZoom,
+							ID:           prodDB.ID,
+							DeletedAt:    prodDB.DeletedAt,
+							MarketZoom:   prodDB.MarketZoom,
+							UpdatedAt:    prodDB.UpdatedAt,
+							PublishState: prodDB.PublishState,
 						})
 					}
 					productFound = true
@@ -319,6 +443,7 @@ func checkConsistency() {
 				productsToRemove = append(productsToRemove, productZoom{
 					ID:           prodR.ID,
 					NeverExisted: true,
+					PublishState: PUBLISH_STATE_DELETED,
 				})
 			}
 		}
@@ -337,27 +462,52 @@ func checkConsistency() {
 		sort.Strings(productsToRemoveList)
 		log.Printf("\tProducts to remove (%d): %s", len(productsToRemove), strings.Join(productsToRemoveList, ", "))
 
+		// Alerts.
+		orphanProductsList := []string{}
+		for _, prod := range productsToRemove {
+			if prod.NeverExisted {
+				orphanProductsList = append(orphanProductsList, prod.ID)
+			}
+		}
+		alertOrphanProducts(orphanProductsList)
+		zunkaActive, zoomActive := 0, 0
+		for _, prodDB := range *prodZoomDBAOk.Products {
+			if prodDB.PublishState.active() {
+				zunkaActive++
+			}
+		}
+		for _, prodR := range *prodZoomRAOK.Products {
+			if prodR.Active {
+				zoomActive++
+			}
+		}
+		alertActiveDrift(zunkaActive, zoomActive)
+
 		// todo - Uncomment begin.
 		// Uncommented, so when aumount charge from zoom is changed, all products are updated.
-		c := make(chan bool)
+		c := make(chan zoomTicketIDOk)
 
-		go updateZoomProducts(productsToUpdate, c)
-		go removeZoomProducts(productsToRemove, c)
+		go updateZoomProducts(ctx, productsToUpdate, c)
+		go removeZoomProducts(ctx, productsToRemove, c)
 
-		// Newest updatedAt product time.
-		if <-c == true && <-c == true {
-			// log.Println("\tCheck consistency finished.")
-		} else {
+		resultUpdate, resultRemove := <-c, <-c
+		if !resultUpdate.Ok || !resultRemove.Ok {
 			log.Println("\tSome thing wrong!.")
+			alertConsistencyFailed("Could not update or remove Zoom products.")
+			return errors.New("Could not update or remove Zoom products.")
 		}
+		// log.Println("\tCheck consistency finished.")
 		// todo - Uncomment finish.
 
 		// b, err := json.MarshalIndent(prodZoomRAOK.Products[8], "", "    ")
 		// checkError(err)
 		// // log.Println("Products all: ", products)
 		// log.Println("Product: ", string(b))
+		alertConsistencyPass(append(productsToUpdateList, productsToRemoveList...))
+		return nil
 	}
-	checkConsistencyTimer = time.AfterFunc(time.Minute*TIME_TO_CHECK_CONCISTENCY_MIN, checkConsistency)
+	alertConsistencyFailed("Could not get Zunka or Zoom products.")
+	return errors.New("Could not get Zunka or Zoom products.")
 }
 
 // Update zoom product.
@@ -407,7 +557,7 @@ func updateOneZoomProduct() {
 }
 
 // Try update prducts from failed ticket.
-func retryFailedUpdateProducts(productsID []string) {
+func retryFailedUpdateProducts(ctx context.Context, productsID []string) {
 	muxUpdateZoomProducts.Lock()
 	defer muxUpdateZoomProducts.Unlock()
 
@@ -417,23 +567,26 @@ func retryFailedUpdateProducts(productsID []string) {
 	// }
 
 	// Get zoom products.
-	zoomProdA := getZunkaProductsByID(productsID)
+	zoomProdA, _, err := getZunkaProductsByID(ctx, productsID)
+	if checkError(err) {
+		return
+	}
 	// log.Printf("Changed zoom products: %+v", zoomProdA)
 
-	c := make(chan bool)
+	c := make(chan zoomTicketIDOk)
 
-	go updateZoomProducts(zoomProdA, c)
-	go removeZoomProducts(zoomProdA, c)
+	go updateZoomProducts(ctx, zoomProdA, c)
+	go removeZoomProducts(ctx, zoomProdA, c)
 
 	<-c
 	<-c
 }
 
-// Return only different products.
-func filterZunkaProductsDiffFromZoomProduct(zunkaProducts []productZoom) (filteredProducts []productZoom) {
+// Return only different products, not ok if could not get Zoom products.
+func filterZunkaProductsDiffFromZoomProduct(ctx context.Context, zunkaProducts []productZoom) (filteredProducts []productZoom, ok bool) {
 	// Get Zoom products.
 	cZoomR := make(chan productZoomRAOk)
-	go getZoomProducts(cZoomR)
+	go getZoomProducts(ctx, cZoomR)
 	zoomProductsRAOK := <-cZoomR
 
 	if zoomProductsRAOK.Ok {
@@ -455,40 +608,75 @@ func filterZunkaProductsDiffFromZoomProduct(zunkaProducts []productZoom) (filter
 			}
 		}
 	}
-	return filteredProducts
+	return filteredProducts, zoomProductsRAOK.Ok
 }
 
-// Check zoom producs.
-func checkProducts() {
+// Check zoom producs changed since last sync.
+func checkProducts(ctx context.Context) error {
 	muxUpdateZoomProducts.Lock()
 	defer muxUpdateZoomProducts.Unlock()
 
-	// // Get zoom products changed.
-	// zoomProdA := getChangedZunkaProducts()
-	// // log.Printf("Changed zoom products: %+v", zoomProdA)
+	// Wait tickets from last run.
+	if pendingProductsWatermark != nil {
+		log.Printf(":: Will not check changed products, waiting to finish %d ticket(s).", len(pendingProductsWatermark.TicketsID))
+		return nil
+	}
+
+	// Get zoom products changed.
+	zunkaProducts, skippedID, err := getChangedZunkaProducts(ctx, newestProductUpdatedAt)
+	if err != nil {
+		return err
+	}
+	if len(zunkaProducts) == 0 {
+		return nil
+	}
+	// Products not decoded are kept at watermark, and checked again.
+	watermark := newProductsWatermark(newestProductUpdatedAt, zunkaProducts, skippedID)
 
 	// Get zoom products and filter products differents from zoom products.
-	zoomProdA := filterZunkaProductsDiffFromZoomProduct(getChangedZunkaProducts())
+	zoomProdA, ok := filterZunkaProductsDiffFromZoomProduct(ctx, zunkaProducts)
+	if !ok {
+		return errors.New("Could not get Zoom products.")
+	}
+	if len(zoomProdA) == 0 {
+		log.Printf(":: Products changed (%d), all equal at Zoom.", len(zunkaProducts))
+		return updateNewestProductUpdatedAt(watermark)
+	}
 
-	if len(zoomProdA) > 0 {
-		log.Println(":: Products changed...")
-		c := make(chan bool)
+	log.Printf(":: Products changed (%d), to sync (%d)...", len(zunkaProducts), len(zoomProdA))
+	c := make(chan zoomTicketIDOk)
 
-		go updateZoomProducts(zoomProdA, c)
-		go removeZoomProducts(zoomProdA, c)
+	go updateZoomProducts(ctx, zoomProdA, c)
+	go removeZoomProducts(ctx, zoomProdA, c)
 
-		// Newest updatedAt product time.
-		if <-c == true && <-c == true {
-			updateNewestProductUpdatedAt()
+	// Newest updatedAt product time is saved after tickets finish successfully.
+	for _, result := range []zoomTicketIDOk{<-c, <-c} {
+		if !result.Ok {
+			return errors.New("Could not update or remove Zoom products, changed products will be synced again.")
+		}
+		if result.TicketID != "" {
+			watermark.TicketsID = append(watermark.TicketsID, result.TicketID)
 		}
-	} else {
-		log.Println("No changed products.")
 	}
-	checkProductsTimer = time.AfterFunc(time.Minute*TIME_TO_CHECK_PRODUCTS_MIN, checkProducts)
+	if len(watermark.TicketsID) == 0 {
+		return updateNewestProductUpdatedAt(watermark)
+	}
+	pendingProductsWatermark = &watermark
+	return nil
 }
 
-// Update zoom products at zoom server.
-func updateZoomProducts(prodA []productZoom, c chan bool) {
+// Update zoom products at zoom server, products in reactivation are not sent.
+func updateZoomProducts(ctx context.Context, prodA []productZoom, c chan zoomTicketIDOk) {
+	products := filterReactivations(prodA)
+	result := postZoomProducts(ctx, products)
+	if result.TicketID != "" {
+		savePublishedFields(products)
+	}
+	c <- result
+}
+
+// Post products that must exist at zoom, available or not.
+func postZoomProducts(ctx context.Context, prodA []productZoom) zoomTicketIDOk {
 	var ticket zoomTicket
 
 	p := struct {
@@ -497,17 +685,19 @@ func updateZoomProducts(prodA []productZoom, c chan bool) {
 		Products: []productZoom{},
 	}
 	for _, product := range prodA {
-		// Update only not deleted products and marked to zoom market place.
-		if product.DeletedAt.IsZero() && product.MarketZoom {
+		if product.PublishState.upsert() {
 			// log.Printf("\tProduct %v changed, UpdatedAt: %v\n", product.ID, product.UpdatedAt.In(brLocation))
 			p.Products = append(p.Products, product)
 			ticket.ProductsID = append(ticket.ProductsID, product.ID)
+			if ticket.PayloadHashes == nil {
+				ticket.PayloadHashes = map[string]string{}
+			}
+			ticket.PayloadHashes[product.ID] = payloadHash(product)
 		}
 	}
 	// Nothing to do.
 	if len(p.Products) == 0 {
-		c <- true
-		return
+		return zoomTicketIDOk{Ok: true}
 	}
 
 	// // Log request.
@@ -516,41 +706,36 @@ func updateZoomProducts(prodA []productZoom, c chan bool) {
 
 	zoomProductsJSON, err := json.Marshal(p)
 	if checkError(err) {
-		c <- false
-		return
+		return zoomTicketIDOk{}
 	}
 	// log.Println("Update zoomProductsJSON:", string(zoomProductsJSON))
 
 	// Request products.
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", zoomHost()+"/products", bytes.NewBuffer(zoomProductsJSON))
+	req, err := http.NewRequestWithContext(ctx, "POST", zoomAPIHost()+"/products", bytes.NewBuffer(zoomProductsJSON))
 	req.Header.Set("Content-Type", "application/json")
 	if checkError(err) {
-		c <- false
-		return
+		return zoomTicketIDOk{}
 	}
 
 	req.SetBasicAuth(zoomUser(), zoomPass())
 	res, err := client.Do(req)
 	if checkError(err) {
-		c <- false
-		return
+		return zoomTicketIDOk{}
 	}
 	defer res.Body.Close()
 
 	// Result.
 	resBody, err := ioutil.ReadAll(res.Body)
 	if checkError(err) {
-		c <- false
-		return
+		return zoomTicketIDOk{}
 	}
 
 	// No success.
 	if res.StatusCode != 200 && res.StatusCode != 201 {
 		err = errors.New(fmt.Sprintf("Not received status 200 neither 201. status: %v, body: %v", res.StatusCode, string(resBody)))
 		_ = checkError(err)
-		c <- false
-		return
+		return zoomTicketIDOk{}
 	}
 	// Log body result.
 	// log.Printf("body: %s", string(resBody))
@@ -558,18 +743,17 @@ func updateZoomProducts(prodA []productZoom, c chan bool) {
 	// Get ticket.
 	err = json.Unmarshal(resBody, &ticket)
 	if checkError(err) {
-		c <- false
-		return
+		return zoomTicketIDOk{}
 	}
 
-	zoomTickets[ticket.ID] = &ticket
-	ticket.ReceivedAt = time.Now()
+	addZoomTicket(&ticket)
 	log.Printf("\tTicket %v added (updated products)", ticket.ID)
-	c <- true
+	saveSyncHistoryPush(p.Products, ticket.ID)
+	return zoomTicketIDOk{TicketID: ticket.ID, Ok: true}
 }
 
 // Remove zoom products at zoom server.
-func removeZoomProducts(prodA []productZoom, c chan bool) {
+func removeZoomProducts(ctx context.Context, prodA []productZoom, c chan zoomTicketIDOk) {
 	var ticket zoomTicket
 
 	// Product id.
@@ -579,17 +763,20 @@ func removeZoomProducts(prodA []productZoom, c chan bool) {
 
 	productIDA := []productID{}
 	for _, product := range prodA {
-		// Remove deleted products and not marked to zoom market place.
-		if !product.DeletedAt.IsZero() || !product.MarketZoom || product.NeverExisted {
+		// Remove products that must not exist at zoom.
+		if product.PublishState.remove() {
 			if product.NeverExisted {
 				// Never existed.
 				log.Printf("\tProduct %v removed, Never existed on Zunka db.", product.ID)
-			} else if !product.DeletedAt.IsZero() {
+			} else if product.PublishState == PUBLISH_STATE_DELETED {
 				// Deleted.
 				log.Printf("\tProduct %v removed, DeletedAt: %v\n", product.ID, product.DeletedAt.In(brLocation))
-			} else if !product.MarketZoom {
+			} else if product.PublishState == PUBLISH_STATE_UNMARKED {
 				// Unmarked to zoom market.
 				log.Printf("\tProduct %v removed, unmarked to zoom market place, UpdatedAt: %v\n", product.ID, product.UpdatedAt.In(brLocation))
+			} else if product.PublishState == PUBLISH_STATE_INVALID {
+				// No price or no name.
+				log.Printf("\tProduct %v removed, invalid (no price or no name), UpdatedAt: %v\n", product.ID, product.UpdatedAt.In(brLocation))
 			}
 			productIDA = append(productIDA, productID{ID: product.ID})
 			ticket.ProductsID = append(ticket.ProductsID, product.ID)
@@ -597,7 +784,7 @@ func removeZoomProducts(prodA []productZoom, c chan bool) {
 	}
 	// Nothing to do.
 	if len(productIDA) == 0 {
-		c <- true
+		c <- zoomTicketIDOk{Ok: true}
 		return
 	}
 
@@ -614,24 +801,24 @@ func removeZoomProducts(prodA []productZoom, c chan bool) {
 
 	zoomProductsJSON, err := json.Marshal(p)
 	if checkError(err) {
-		c <- false
+		c <- zoomTicketIDOk{}
 		return
 	}
 
 	// log.Println("Delete zoomProductsJSON:", string(zoomProductsJSON))
 	// Request products.
 	client := &http.Client{}
-	req, err := http.NewRequest("DELETE", zoomHost()+"/products", bytes.NewBuffer(zoomProductsJSON))
+	req, err := http.NewRequestWithContext(ctx, "DELETE", zoomAPIHost()+"/products", bytes.NewBuffer(zoomProductsJSON))
 	req.Header.Set("Content-Type", "application/json")
 	if checkError(err) {
-		c <- false
+		c <- zoomTicketIDOk{}
 		return
 	}
 
 	req.SetBasicAuth(zoomUser(), zoomPass())
 	res, err := client.Do(req)
 	if checkError(err) {
-		c <- false
+		c <- zoomTicketIDOk{}
 		return
 	}
 	defer res.Body.Close()
@@ -639,7 +826,7 @@ func removeZoomProducts(prodA []productZoom, c chan bool) {
 	// Result.
 	resBody, err := ioutil.ReadAll(res.Body)
 	if checkError(err) {
-		c <- false
+		c <- zoomTicketIDOk{}
 		return
 	}
 
@@ -647,7 +834,7 @@ func removeZoomProducts(prodA []productZoom, c chan bool) {
 	if res.StatusCode != 200 && res.StatusCode != 201 {
 		err = errors.New(fmt.Sprintf("Not received status 200 neither 201. status: %v, body: %v", res.StatusCode, string(resBody)))
 		_ = checkError(err)
-		c <- false
+		c <- zoomTicketIDOk{}
 		return
 	}
 	// Log body result.
@@ -656,21 +843,21 @@ func removeZoomProducts(prodA []productZoom, c chan bool) {
 	// Get ticket.
 	err = json.Unmarshal(resBody, &ticket)
 	if checkError(err) {
-		c <- false
+		c <- zoomTicketIDOk{}
 		return
 	}
 
-	zoomTickets[ticket.ID] = &ticket
-	ticket.ReceivedAt = time.Now()
+	addZoomTicket(&ticket)
 	log.Printf("\tTicket %v added (removed products)", ticket.ID)
-	c <- true
+	saveSyncHistoryDelete(ticket.ProductsID, ticket.ID)
+	c <- zoomTicketIDOk{TicketID: ticket.ID, Ok: true}
 }
 
 /******************************************************************************
 * TICKET
 ******************************************************************************/
 // Check if tickets finished.
-func checkTickets() {
+func checkTickets(ctx context.Context) error {
 	muxUpdateZoomProducts.Lock()
 	defer muxUpdateZoomProducts.Unlock()
 
@@ -679,56 +866,92 @@ func checkTickets() {
 	ticketsIDToRemove := []string{}
 	// Range of tikcets.
 	for k, v := range zoomTickets {
+		// Shutting down.
+		if ctx.Err() != nil {
+			break
+		}
 		// Give up get ticket result and check zoom products consistency.
 		elapsedTimeInSeconds := time.Since(v.ReceivedAt).Seconds()
 		if elapsedTimeInSeconds > ZOOM_TICKET_DEADLINE_MIN*60 {
 			// Set ticket to be deleted and retry update products.
 			ticketsIDToRemove = append(ticketsIDToRemove, k)
 			log.Printf("Give up ticket %v, TickCount: %d, Elapsed time: %.1f s\n", v.ID, v.TickCount, elapsedTimeInSeconds)
+			zoomTicketGivenUp(v)
 			// go retryFailedUpdateProducts(v.ProductsID)
 			continue
 		}
 		// Checkt ticket.
 		v.TickCount = v.TickCount + 1
 		log.Printf(":: Checking ticket %v, TickCount: %d, Elapsed time: %.1f s\n", v.ID, v.TickCount, elapsedTimeInSeconds)
-		receipt, err := getZoomReceipt(k)
+		receipt, err := getZoomReceipt(ctx, k)
 		if err != nil {
 			log.Println(fmt.Sprintf("\tError getting zoom ticket. %v\n.", err))
 			continue
 		}
 		// Finished.
 		if receipt.Finished {
-			notSuccessfulProductsId := []string{}
-			// log.Printf("Ticket zoom finished. ID: %v, Receipt: %v\n", v.ID, receipt)
-			log.Printf("\tTicket %v finished\n", v.ID)
-			for _, result := range receipt.Results {
-				log.Printf("\tProductID: %s, Status: %d, Message: %s, WarnMessages: %s\n", result.ProductID, result.Status, result.Message, result.WarnMessages)
-				// Product update failed.
-				// 404, trying to delete nonexistent product.
-				if result.Status != 200 && result.Status != 201 && result.Status != 404 {
-					notSuccessfulProductsId = append(notSuccessfulProductsId, result.ProductID)
-				}
-			}
-			// Retry not successful updated products.
-			if len(notSuccessfulProductsId) > 0 {
-				// go retryFailedUpdateProducts(notSuccessfulProductsId)
-			}
+			zoomTicketFinished(v, &receipt)
 			ticketsIDToRemove = append(ticketsIDToRemove, k)
 		}
 	}
 	// Remove completed or failed tickets.
 	for _, ticketId := range ticketsIDToRemove {
-		delete(zoomTickets, ticketId)
+		removeZoomTicket(ticketId)
 		// log.Printf("\tTicket %v removed\n", ticketId)
 	}
-	checkTicketsTimer = time.AfterFunc(time.Minute*TIME_TO_CHECK_TICKETS_MIN, checkTickets)
+	checkReactivations(ctx)
+	return nil
+}
+
+// Ticket finished, must be called with muxUpdateZoomProducts locked.
+func zoomTicketFinished(v *zoomTicket, receipt *zoomReceipt) {
+	// Order status.
+	if v.OrderID != "" {
+		log.Printf("\tTicket %v finished (order %s)\n", v.ID, v.OrderID)
+		orderStatusTicketFinished(v, receipt)
+		return
+	}
+	notSuccessfulProductsId := []string{}
+	// log.Printf("Ticket zoom finished. ID: %v, Receipt: %v\n", v.ID, receipt)
+	log.Printf("\tTicket %v finished\n", v.ID)
+	saveSyncHistoryReceipt(v.ID, receipt)
+	updateZunkaProductsZoomStatusReceipt(v, receipt)
+	for _, result := range receipt.Results {
+		log.Printf("\tProductID: %s, Status: %d, Message: %s, WarnMessages: %s\n", result.ProductID, result.Status, result.Message, result.WarnMessages)
+		// Product update failed.
+		// 404, trying to delete nonexistent product.
+		if result.Status != 200 && result.Status != 201 && result.Status != 404 {
+			notSuccessfulProductsId = append(notSuccessfulProductsId, result.ProductID)
+		}
+	}
+	// Retry not successful updated products.
+	if len(notSuccessfulProductsId) > 0 {
+		// go retryFailedUpdateProducts(notSuccessfulProductsId)
+	}
+	alertReceiptFailures(v, notSuccessfulProductsId, len(receipt.Results))
+	productsWatermarkTicketFinished(v.ID, len(notSuccessfulProductsId) == 0)
+	changeStreamTicketFinished(v.ID, len(notSuccessfulProductsId) == 0)
+	reactivationTicketFinished(v.ID, len(notSuccessfulProductsId) == 0)
+}
+
+// Ticket given up, must be called with muxUpdateZoomProducts locked.
+func zoomTicketGivenUp(v *zoomTicket) {
+	if v.OrderID != "" {
+		orderStatusTicketFinished(v, nil)
+		return
+	}
+	alertTicketGivenUp(v)
+	saveSyncHistoryGiveUp(v)
+	productsWatermarkTicketFinished(v.ID, false)
+	changeStreamTicketFinished(v.ID, false)
+	reactivationTicketFinished(v.ID, false)
 }
 
 /******************************************************************************
 * ZOOM PRODUCTS AND RECEIPTS
 ******************************************************************************/
 // Get products from zoom webservice.
-func getZoomProducts(c chan productZoomRAOk) {
+func getZoomProducts(ctx context.Context, c chan productZoomRAOk) {
 
 	type PaginationType struct {
 		CurrentPage     int `json:"current_page"`
@@ -753,7 +976,7 @@ func getZoomProducts(c chan productZoomRAOk) {
 	client := &http.Client{}
 	// req, err := http.NewRequest("GET", "http://merchant.zoom.com.br/api/merchant/products", nil)
 	// req, err := http.NewRequest("GET", "https://staging-merchant.zoom.com.br/api/merchant/products", nil)
-	req, err := http.NewRequest("GET", zoomHost()+"/products", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", zoomAPIHost()+"/products", nil)
 	if checkError(err) {
 		c <- result
 		return
@@ -828,11 +1051,11 @@ func getZoomProducts(c chan productZoomRAOk) {
 }
 
 // Get receipt information.
-func getZoomReceipt(ticketId string) (receipt zoomReceipt, err error) {
+func getZoomReceipt(ctx context.Context, ticketId string) (receipt zoomReceipt, err error) {
 	// Request products.
 	client := &http.Client{}
 	// log.Println("host:", zoomHost()+"/receipt/"+ticketId)
-	req, err := http.NewRequest("GET", zoomHost()+"/receipt/"+ticketId, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", zoomAPIHost()+"/receipt/"+ticketId, nil)
 	req.Header.Set("Content-Type", "application/json")
 	if err != nil {
 		return receipt, errors.New(fmt.Sprintf("Error creating ticket request.  %v\n", err))
@@ -872,14 +1095,21 @@ func getZoomReceipt(ticketId string) (receipt zoomReceipt, err error) {
 /******************************************************************************
 * ZUNKA PRODUCTS
 ******************************************************************************/
-// Get Zunka products changed.
-func getChangedZunkaProducts() (products []productZoom) {
-	// To save the new one when finish.
-	newestProductUpdatedAtTemp = newestProductUpdatedAt
+// Get Zunka products changed after watermark.
+func getChangedZunkaProducts(ctx context.Context, watermark productsWatermark) (products []productZoom, skippedID []string, err error) {
+	objectIDs, err := zunkaObjectIDs(watermark.ProductsID)
+	if err != nil {
+		return products, skippedID, err
+	}
+	skippedObjectIDs, err := zunkaObjectIDs(watermark.SkippedID)
+	if err != nil {
+		return products, skippedID, err
+	}
 
 	collection := client.Database("zunka").Collection("products")
 
-	ctxFind, _ := context.WithTimeout(context.Background(), 3*time.Second)
+	ctxFind, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 	// D: A BSON document. This type should be used in situations where order matters, such as MongoDB commands.
 	// M: An unordered map. It is the same as D, except it does not preserve order.
 	// A: A BSON array.
@@ -898,59 +1128,39 @@ func getChangedZunkaProducts() (products []productZoom) {
 		// {"storeProductTitle", bson.D{
 		// {"$regex", `\S`},
 		// }},
-		{"updatedAt", bson.D{
-			{"$gt", newestProductUpdatedAt},
+		// Products updated after watermark or with same updated time and not synced yet, or not decoded before.
+		{"$or", bson.A{
+			bson.D{{"updatedAt", bson.D{{"$gt", watermark.UpdatedAt}}}},
+			bson.D{
+				{"updatedAt", watermark.UpdatedAt},
+				{"_id", bson.D{{"$nin", objectIDs}}},
+			},
+			bson.D{{"_id", bson.D{{"$in", skippedObjectIDs}}}},
 		}},
 	}
 	findOptions := options.Find()
-	findOptions.SetProjection(bson.D{
-		{"_id", true},
-		{"storeProductTitle", true},
-		{"storeProductCategory", true},
-		{"storeProductDetail", true},
-		{"storeProductTechnicalInformation", true}, // To get EAN if not have EAN.
-		{"storeProductLength", true},
-		{"storeProductHeight", true},
-		{"storeProductWidth", true},
-		{"storeProductWeight", true},
-		{"storeProductCommercialize", true},
-		{"storeProductPrice", true},
-		{"storeProductQtd", true},
-		{"ean", true},
-		{"images", true},
-		{"marketZoom", true},
-		{"updatedAt", true},
-		{"deletedAt", true},
-	})
+	findOptions.SetProjection(zunkaProductProjection)
 	// todo - comment.
 	// findOptions.SetLimit(12)
 	cur, err := collection.Find(ctxFind, filter, findOptions)
-	checkFatalError(err)
-	defer cur.Close(ctxFind)
-
-	for cur.Next(ctxFind) {
-		prodZunka := productZunka{}
-		err := cur.Decode(&prodZunka)
-		checkFatalError(err)
-
-		prodZoom := *convertProductZunkaToZoom(&prodZunka)
-		products = append(products, prodZoom)
-	}
-	if err := cur.Err(); err != nil {
-		log.Fatal(err)
+	if err != nil {
+		return products, skippedID, err
 	}
-	return products
+	defer cur.Close(ctxFind)
+	// Products that could not be decoded are not synced.
+	return readZunkaProducts(ctxFind, cur)
 }
 
 // Get all Zunka products.
-func getAllZunkaProducts(c chan productZoomAOk) {
+func getAllZunkaProducts(ctx context.Context, c chan productZoomAOk) {
 	result := productZoomAOk{
 		Ok:       false,
 		Products: &[]productZoom{},
 	}
 	collection := client.Database("zunka").Collection("products")
 
-	ctxFind, _ := context.WithTimeout(context.Background(), 3*time.Second)
+	ctxFind, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 	// D: A BSON document. This type should be used in situations where order matters, such as MongoDB commands.
 	// M: An unordered map. It is the same as D, except it does not preserve order.
 	// A: A BSON array.
@@ -976,25 +1186,7 @@ func getAllZunkaProducts(c chan productZoomAOk) {
 		// }},
 	}
 	findOptions := options.Find()
-	findOptions.SetProjection(bson.D{
-		{"_id", true},
-		{"storeProductTitle", true},
-		{"storeProductCategory", true},
-		{"storeProductDetail", true},
-		{"storeProductTechnicalInformation", true}, // To get EAN if not have EAN.
-		{"storeProductLength", true},
-		{"storeProductHeight", true},
-		{"storeProductWidth", true},
-		{"storeProductWeight", true},
-		{"storeProductCommercialize", true},
-		{"storeProductPrice", true},
-		{"storeProductQtd", true},
-		{"ean", true},
-		{"marketZoom", true},
-		{"images", true},
-		{"updatedAt", true},
-		{"deletedAt", true},
-	})
+	findOptions.SetProjection(zunkaProductProjection)
 	// todo - comment.
 	// findOptions.SetLimit(12)
 	cur, err := collection.Find(ctxFind, filter, findOptions)
@@ -1004,26 +1196,17 @@ func getAllZunkaProducts(c chan productZoomAOk) {
 	}
 
 	defer cur.Close(ctxFind)
-	for cur.Next(ctxFind) {
-		prodZunka := productZunka{}
-		err := cur.Decode(&prodZunka)
-		if checkError(err) {
-			c <- result
-			return
-		}
-
-		prodZoom := convertProductZunkaToZoom(&prodZunka)
-		// log.Printf("prodZoom.ID: %+v\n", prodZoom.ID)
-		*result.Products = append(*result.Products, *prodZoom)
-	}
-	if err := cur.Err(); err != nil {
-		log.Fatal(err)
+	*result.Products, result.SkippedID, err = readZunkaProducts(ctxFind, cur)
+	if checkError(err) {
+		c <- result
+		return
 	}
+	pruneBrokenImages(*result.Products, result.SkippedID)
 	// log.Printf("Products count: %v\n", len(*result.Products))
 	validProductsCount := 0
 	validProductsList := []string{}
 	for _, product := range *result.Products {
-		if product.Availability && product.MarketZoom {
+		if product.PublishState == PUBLISH_STATE_PUBLISHABLE {
 			validProductsList = append(validProductsList, product.ID)
 			validProductsCount++
 		}
@@ -1031,19 +1214,18 @@ func getAllZunkaProducts(c chan productZoomAOk) {
 	sort.Strings(validProductsList)
 	// log.Printf("\tActive Zunka products (%d): %s", validProductsCount, strings.Join(validProductsList, ", "))
 	log.Printf("\tActive Zunka products: (%d)", validProductsCount)
+	logBrokenImages(*result.Products)
 
 	result.Ok = true
 	c <- result
 }
 
-// Get Zunka products changed.
-func getZunkaProductsByID(productsID []string) (products []productZoom) {
-	// To save the new one when finish.
-	newestProductUpdatedAtTemp = newestProductUpdatedAt
-
+// Get Zunka products by id, with products id that could not be decoded.
+func getZunkaProductsByID(ctx context.Context, productsID []string) (products []productZoom, skippedID []string, err error) {
 	collection := client.Database("zunka").Collection("products")
 
-	ctxFind, _ := context.WithTimeout(context.Background(), 3*time.Second)
+	ctxFind, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 	// D: A BSON document. This type should be used in situations where order matters, such as MongoDB commands.
 	// M: An unordered map. It is the same as D, except it does not preserve order.
 	// A: A BSON array.
@@ -1051,11 +1233,9 @@ func getZunkaProductsByID(productsID []string) (products []productZoom) {
 	// options.Find().SetProjection(bson.D{{"storeProductTitle", true}, {"_id", false}}),
 	// {'storeProductCommercialize': true, 'storeProductTitle': {$regex: /\S/}, 'storeProductQtd': {$gt: 0}, 'storeProductPrice': {$gt: 0}};
 
-	objectIDs := []primitive.ObjectID{}
-	for _, id := range productsID {
-		objId, err := primitive.ObjectIDFromHex(id)
-		checkFatalError(err)
-		objectIDs = append(objectIDs, objId)
+	objectIDs, err := zunkaObjectIDs(productsID)
+	if err != nil {
+		return products, skippedID, err
 	}
 
 	// log.Printf("objectIDs: %+v", objectIDs)
@@ -1067,42 +1247,57 @@ func getZunkaProductsByID(productsID []string) (products []productZoom) {
 	}
 
 	findOptions := options.Find()
-	findOptions.SetProjection(bson.D{
-		{"_id", true},
-		{"storeProductTitle", true},
-		{"storeProductCategory", true},
-		{"storeProductDetail", true},
-		{"storeProductTechnicalInformation", true}, // To get EAN if not have EAN.
-		{"storeProductLength", true},
-		{"storeProductHeight", true},
-		{"storeProductWidth", true},
-		{"storeProductWeight", true},
-		{"storeProductCommercialize", true},
-		{"storeProductPrice", true},
-		{"storeProductQtd", true},
-		{"ean", true},
-		{"images", true},
-		{"updatedAt", true},
-		{"deletedAt", true},
-	})
+	findOptions.SetProjection(zunkaProductProjection)
 	// todo - comment.
 	// findOptions.SetLimit(12)
 	cur, err := collection.Find(ctxFind, filter, findOptions)
-	checkFatalError(err)
+	if err != nil {
+		return products, skippedID, err
+	}
 	defer cur.Close(ctxFind)
+	return readZunkaProducts(ctxFind, cur)
+}
 
-	for cur.Next(ctxFind) {
+// Read Zunka products from cursor, products that could not be decoded are skipped and returned by id,
+// so they are not considered removed from Zunka.
+func readZunkaProducts(ctx context.Context, cur *mongo.Cursor) (products []productZoom, skippedID []string, err error) {
+	products = []productZoom{}
+	skippedID = []string{}
+	prodsZunka := []productZunka{}
+	for cur.Next(ctx) {
 		prodZunka := productZunka{}
 		err := cur.Decode(&prodZunka)
-		checkFatalError(err)
-
-		prodZoom := *convertProductZunkaToZoom(&prodZunka)
-		products = append(products, prodZoom)
+		if err != nil {
+			id, _ := cur.Current.Lookup("_id").ObjectIDOK()
+			log.Printf("[warn] Skipped product %s, could not decode it. %v", id.Hex(), err)
+			skippedID = append(skippedID, id.Hex())
+			continue
+		}
+		prodsZunka = append(prodsZunka, prodZunka)
+	}
+	if err = cur.Err(); err != nil {
+		return products, skippedID, err
 	}
-	if err := cur.Err(); err != nil {
-		log.Fatal(err)
+	// Images checked before conversion, not one by one.
+	checkProductsImages(prodsZunka)
+	for i := range prodsZunka {
+		prodZoom := convertProductZunkaToZoom(&prodsZunka[i])
+		products = append(products, *prodZoom)
 	}
-	return products
+	return products, skippedID, nil
+}
+
+// Object ids from Zunka products id.
+func zunkaObjectIDs(productsID []string) (objectIDs []primitive.ObjectID, err error) {
+	objectIDs = []primitive.ObjectID{}
+	for _, id := range productsID {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return objectIDs, err
+		}
+		objectIDs = append(objectIDs, objectID)
+	}
+	return objectIDs, nil
 }
 
 // Convert Zunka product to Zoom product.
@@ -1119,14 +1314,13 @@ func convertProductZunkaToZoom(prodZunka *productZunka) (prodZoom *productZoom)
 	// Sub department.
 	prodZoom.SubDepartment = prodZunka.Category
 	// Dimensions.
-	prodZoom.Dimensions.CrossDocking = 2 // ?
+	prodZoom.Dimensions.CrossDocking = crossDocking(prodZunka)
 	prodZoom.Dimensions.Length = fmt.Sprintf("%.3f", float64(prodZunka.Length)/100)
 	prodZoom.Dimensions.Height = fmt.Sprintf("%.3f", float64(prodZunka.Height)/100)
 	prodZoom.Dimensions.Width = fmt.Sprintf("%.3f", float64(prodZunka.Width)/100)
 	prodZoom.Dimensions.Weight = strconv.Itoa(prodZunka.Weight)
 	// Free shipping.
-	prodZoom.FreeShipping = false
-	// prodZoom.FreeShipping = "false"
+	prodZoom.FreeShipping = freeShipping(prodZunka)
 	// EAN.
 	if prodZunka.EAN == "" {
 		prodZunka.EAN = findEan(prodZunka.TechInfo, prodZunka.ObjectID.String())
@@ -1142,9 +1336,14 @@ func convertProductZunkaToZoom(prodZunka *productZunka) (prodZoom *productZoom)
 	prodZoom.Installments.AmountMonths = 3
 	// prodZoom.Installments.Price = fmt.Sprintf("%.2f", float64(int((prodZunka.Price/3)*100))/100)
 	prodZoom.Installments.Price = prodZunka.Price
-	prodZoom.Quantity = prodZunka.Quantity
-	if prodZunka.Commercialize && (prodZunka.Quantity > 0) && (prodZunka.Price > 0) && (prodZunka.Name != "") {
+	// Published quantity, not Zunka quantity.
+	prodZoom.Quantity = publishedQuantity(prodZunka)
+	prodZoom.PublishState = getPublishState(prodZunka, prodZoom.Quantity)
+	// Out of stock products are published as unavailable.
+	if prodZoom.PublishState == PUBLISH_STATE_PUBLISHABLE {
 		prodZoom.Availability = true
+	} else {
+		prodZoom.Quantity = 0
 	}
 	if prodZunka.Commercialize && prodZunka.MarketZoom {
 		prodZoom.MarketZoom = true
@@ -1152,20 +1351,29 @@ func convertProductZunkaToZoom(prodZunka *productZunka) (prodZoom *productZoom)
 	// prodZoom.Availability = strconv.FormatBool(prodZunka.Active)
 	prodZoom.Url = "https://www.zunka.com.br/product/" + prodZoom.ID
 	// Images.
-	for index, urlImage := range prodZunka.Images {
-		if index == 0 {
-			prodZoom.UrlImages = append(prodZoom.UrlImages, urlImageZoom{"true", "https://www.zunka.com.br/img/" + prodZoom.ID + "/" + urlImage})
-		} else {
-			prodZoom.UrlImages = append(prodZoom.UrlImages, urlImageZoom{"false", "https://www.zunka.com.br/img/" + prodZoom.ID + "/" + urlImage})
-		}
+	var imagesBroken []string
+	prodZoom.UrlImages, imagesBroken = convertZunkaImagesToZoom(prodZoom.ID, prodZunka)
+	// Validation errors.
+	if prodZunka.Price <= 0 {
+		prodZoom.ValidationErrors = append(prodZoom.ValidationErrors, "No price")
+	}
+	if prodZunka.Name == "" {
+		prodZoom.ValidationErrors = append(prodZoom.ValidationErrors, "No name")
+	}
+	if len(prodZoom.UrlImages) == 0 {
+		prodZoom.ValidationErrors = append(prodZoom.ValidationErrors, "No image")
+	}
+	for _, image := range imagesBroken {
+		prodZoom.ValidationErrors = append(prodZoom.ValidationErrors, "Broken image "+image)
 	}
 	prodZoom.UpdatedAt = prodZunka.UpdatedAt
 	prodZoom.DeletedAt = prodZunka.DeletedAt
-	// Set newest updated time.
-	if prodZunka.UpdatedAt.After(newestProductUpdatedAtTemp) {
-		// log.Println("time updated")
-		newestProductUpdatedAtTemp = prodZunka.UpdatedAt
-	}
+	prodZoom.PublishedHash = prodZunka.ZoomStatus.PayloadHash
+	prodZoom.RejectedHash = prodZunka.ZoomStatus.RejectedHash
+	prodZoom.ZunkaPrice = prodZunka.Price
+	prodZoom.ZunkaQuantity = prodZunka.Quantity
+	prodZoom.ZunkaMarketZoom = prodZunka.MarketZoom
+	prodZoom.ZunkaCommercialize = prodZunka.Commercialize
 	return prodZoom
 }
 
@@ -0,0 +1,65 @@
+package main
+
+// Product publish state at Zoom.
+type publishState int
+
+const (
+	PUBLISH_STATE_PUBLISHABLE  publishState = iota // Upserted as available.
+	PUBLISH_STATE_OUT_OF_STOCK                     // Upserted as unavailable.
+	PUBLISH_STATE_INVALID                          // Removed, no price or no name.
+	PUBLISH_STATE_UNMARKED                         // Removed, not marked to Zoom market or not commercialized.
+	PUBLISH_STATE_DELETED                          // Removed, deleted at Zunka or never existed.
+)
+
+func (s publishState) String() string {
+	switch s {
+	case PUBLISH_STATE_PUBLISHABLE:
+		return "publishable"
+	case PUBLISH_STATE_OUT_OF_STOCK:
+		return "out-of-stock"
+	case PUBLISH_STATE_INVALID:
+		return "invalid"
+	case PUBLISH_STATE_UNMARKED:
+		return "unmarked"
+	case PUBLISH_STATE_DELETED:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// Product must exist at Zoom.
+func (s publishState) upsert() bool {
+	return s == PUBLISH_STATE_PUBLISHABLE || s == PUBLISH_STATE_OUT_OF_STOCK
+}
+
+// Product reported as active by Zoom, out of stock products are published as unavailable.
+func (s publishState) active() bool {
+	return s == PUBLISH_STATE_PUBLISHABLE
+}
+
+// Product must not exist at Zoom.
+func (s publishState) remove() bool {
+	return !s.upsert()
+}
+
+// Publish state from Zunka product and published quantity.
+func getPublishState(prodZunka *productZunka, quantity int) publishState {
+	return getMarketPublishState(prodZunka, prodZunka.MarketZoom, quantity)
+}
+
+// Publish state at a marketplace, marked is the marketplace flag, like marketZoom.
+func getMarketPublishState(prodZunka *productZunka, marked bool, quantity int) publishState {
+	if !prodZunka.DeletedAt.IsZero() {
+		return PUBLISH_STATE_DELETED
+	}
+	if !marked || !prodZunka.Commercialize {
+		return PUBLISH_STATE_UNMARKED
+	}
+	if prodZunka.Price <= 0 || prodZunka.Name == "" {
+		return PUBLISH_STATE_INVALID
+	}
+	if quantity <= 0 {
+		return PUBLISH_STATE_OUT_OF_STOCK
+	}
+	return PUBLISH_STATE_PUBLISHABLE
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetPublishState(t *testing.T) {
+	valid := productZunka{Name: "Notebook", Price: 100, Commercialize: true, MarketZoom: true}
+	with := func(f func(p *productZunka)) productZunka {
+		p := valid
+		f(&p)
+		return p
+	}
+
+	tests := []struct {
+		name      string
+		prodZunka productZunka
+		quantity  int
+		want      publishState
+	}{
+		{"publishable", valid, 1, PUBLISH_STATE_PUBLISHABLE},
+		{"out of stock", valid, 0, PUBLISH_STATE_OUT_OF_STOCK},
+		{"no price", with(func(p *productZunka) { p.Price = 0 }), 1, PUBLISH_STATE_INVALID},
+		{"no name", with(func(p *productZunka) { p.Name = "" }), 1, PUBLISH_STATE_INVALID},
+		{"not marked", with(func(p *productZunka) { p.MarketZoom = false }), 1, PUBLISH_STATE_UNMARKED},
+		{"not commercialized", with(func(p *productZunka) { p.Commercialize = false }), 1, PUBLISH_STATE_UNMARKED},
+		{"not marked and invalid", with(func(p *productZunka) { p.MarketZoom = false; p.Price = 0 }), 1, PUBLISH_STATE_UNMARKED},
+		{"deleted", with(func(p *productZunka) { p.DeletedAt = time.Now() }), 1, PUBLISH_STATE_DELETED},
+	}
+	for _, tt := range tests {
+		got := getPublishState(&tt.prodZunka, tt.quantity)
+		if got != tt.want {
+			t.Errorf("%s: getPublishState() = %v, want %v", tt.name, got, tt.want)
+		}
+		if got.upsert() == got.remove() {
+			t.Errorf("%s: %v must be upserted or removed", tt.name, got)
+		}
+		if got.active() && !got.upsert() {
+			t.Errorf("%s: %v active at Zoom must be upserted", tt.name, got)
+		}
+	}
+}
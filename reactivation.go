@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reactivation steps.
+const (
+	REACTIVATION_STEP_REMOVE   = "remove"   // Remove product from Zoom.
+	REACTIVATION_STEP_REMOVING = "removing" // Waiting remove ticket.
+	REACTIVATION_STEP_WAITING  = "waiting"  // Waiting delay to create product again.
+	REACTIVATION_STEP_CREATING = "creating" // Waiting create ticket.
+)
+
+// Product removed from Zoom and created again after some time, because some field changed.
+type reactivation struct {
+	ProductID     string   `bson:"_id"`
+	Step          string   `bson:"step"`
+	TicketID      string   `bson:"ticketID"`
+	ChangedFields []string `bson:"changedFields"`
+	// Fields of product sent to create it again, saved as published when created.
+	Fields       map[string]string `bson:"fields"`
+	ReactivateAt time.Time         `bson:"reactivateAt"`
+	CreatedAt    time.Time         `bson:"createdAt"`
+}
+
+// Reactivations in progress, by product id.
+var reactivations = map[string]*reactivation{}
+
+// Load reactivations in progress from db.
+func loadReactivations() {
+	reactivations = map[string]*reactivation{}
+	collection := client.Database("zunka").Collection("zoomReactivations")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cur, err := collection.Find(ctx, bson.D{})
+	if checkError(err) {
+		return
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		r := reactivation{}
+		if checkError(cur.Decode(&r)) {
+			continue
+		}
+		// Ticket not checked anymore, so remove or create again.
+		if _, ok := zoomTickets[r.TicketID]; !ok {
+			r.ticketFinished(false, time.Now())
+		}
+		reactivations[r.ProductID] = &r
+	}
+	checkError(cur.Err())
+	if len(reactivations) > 0 {
+		log.Printf("Reactivations in progress: %d", len(reactivations))
+	}
+}
+
+// Save reactivation into db.
+func saveReactivation(r *reactivation) {
+	collection := client.Database("zunka").Collection("zoomReactivations")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": r.ProductID}, r, options.Replace().SetUpsert(true))
+	checkError(err)
+}
+
+// Remove reactivation from db.
+func deleteReactivation(productID string) {
+	delete(reactivations, productID)
+	collection := client.Database("zunka").Collection("zoomReactivations")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": productID})
+	checkError(err)
+}
+
+// Product fields that trigger reactivation, by json name.
+func publishedFields(product *productZoom) map[string]string {
+	fields := map[string]string{}
+	if len(config.Reactivation.Fields) == 0 {
+		return fields
+	}
+	productJSON, err := json.Marshal(product)
+	if checkError(err) {
+		return fields
+	}
+	productMap := map[string]interface{}{}
+	if checkError(json.Unmarshal(productJSON, &productMap)) {
+		return fields
+	}
+	for _, field := range config.Reactivation.Fields {
+		fields[field] = fmt.Sprint(productMap[field])
+	}
+	return fields
+}
+
+// Get published fields saved into db.
+func getPublishedFields(productsID []string) map[string]map[string]string {
+	result := map[string]map[string]string{}
+	collection := client.Database("zunka").Collection("zoomPublishedFields")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cur, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": productsID}})
+	if checkError(err) {
+		return result
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		doc := struct {
+			ProductID string            `bson:"_id"`
+			Fields    map[string]string `bson:"fields"`
+		}{}
+		if checkError(cur.Decode(&doc)) {
+			continue
+		}
+		result[doc.ProductID] = doc.Fields
+	}
+	checkError(cur.Err())
+	return result
+}
+
+// Save published fields into db, for products that must exist at Zoom.
+func savePublishedFields(products []productZoom) {
+	if len(config.Reactivation.Fields) == 0 {
+		return
+	}
+	fields := map[string]map[string]string{}
+	for i := range products {
+		if products[i].PublishState.upsert() {
+			fields[products[i].ID] = publishedFields(&products[i])
+		}
+	}
+	savePublishedFieldsByID(fields)
+}
+
+// Save published fields into db, by product id.
+func savePublishedFieldsByID(fields map[string]map[string]string) {
+	if len(fields) == 0 {
+		return
+	}
+	models := []mongo.WriteModel{}
+	for id, productFields := range fields {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"fields": productFields, "updatedAt": time.Now()}}).
+			SetUpsert(true))
+	}
+	collection := client.Database("zunka").Collection("zoomPublishedFields")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.BulkWrite(ctx, models)
+	checkError(err)
+}
+
+// Remove products in reactivation and start reactivation for products with changed fields.
+func filterReactivations(prodA []productZoom) (filtered []productZoom) {
+	productsID := []string{}
+	for _, product := range prodA {
+		if product.PublishState.upsert() {
+			productsID = append(productsID, product.ID)
+		}
+	}
+	savedFields := map[string]map[string]string{}
+	if len(config.Reactivation.Fields) > 0 && len(productsID) > 0 {
+		savedFields = getPublishedFields(productsID)
+	}
+
+	for i, product := range prodA {
+		if !product.PublishState.upsert() {
+			filtered = append(filtered, product)
+			continue
+		}
+		// Reactivation in progress, product is created again by reactivation.
+		if _, ok := reactivations[product.ID]; ok {
+			continue
+		}
+		// Never published.
+		fields, ok := savedFields[product.ID]
+		if !ok {
+			filtered = append(filtered, product)
+			continue
+		}
+		changedFields := []string{}
+		for field, value := range publishedFields(&prodA[i]) {
+			if fields[field] != value {
+				changedFields = append(changedFields, field)
+			}
+		}
+		if len(changedFields) == 0 {
+			filtered = append(filtered, product)
+			continue
+		}
+		sort.Strings(changedFields)
+		r := &reactivation{
+			ProductID:     product.ID,
+			Step:          REACTIVATION_STEP_REMOVE,
+			ChangedFields: changedFields,
+			CreatedAt:     time.Now(),
+		}
+		reactivations[product.ID] = r
+		saveReactivation(r)
+		log.Printf("\tProduct %v will be reactivated, changed fields: %s", product.ID, strings.Join(changedFields, ", "))
+	}
+	return filtered
+}
+
+// Ticket sent for reactivation step, to remove or to create product.
+func (r *reactivation) ticketSent(ticketID string) {
+	switch r.Step {
+	case REACTIVATION_STEP_REMOVE:
+		r.Step = REACTIVATION_STEP_REMOVING
+	case REACTIVATION_STEP_WAITING:
+		r.Step = REACTIVATION_STEP_CREATING
+	default:
+		return
+	}
+	r.TicketID = ticketID
+}
+
+// Ticket finished for reactivation step, done when create ticket finished successfully.
+func (r *reactivation) ticketFinished(ok bool, now time.Time) (done bool) {
+	switch r.Step {
+	case REACTIVATION_STEP_REMOVING:
+		if ok {
+			r.Step = REACTIVATION_STEP_WAITING
+			r.ReactivateAt = now.Add(time.Duration(config.Reactivation.DelayMin) * time.Minute)
+		} else {
+			// Try remove again.
+			r.Step = REACTIVATION_STEP_REMOVE
+		}
+	case REACTIVATION_STEP_CREATING:
+		if ok {
+			return true
+		}
+		// Try create again.
+		r.Step = REACTIVATION_STEP_WAITING
+	default:
+		return false
+	}
+	r.TicketID = ""
+	return false
+}
+
+// Reactivation ticket finished, fields sent are published when product is created again.
+func reactivationTicketFinished(ticketID string, ok bool) {
+	for id, r := range reactivations {
+		if r.TicketID != ticketID {
+			continue
+		}
+		if r.ticketFinished(ok, time.Now()) {
+			savePublishedFieldsByID(map[string]map[string]string{id: r.Fields})
+			deleteReactivation(id)
+			continue
+		}
+		saveReactivation(r)
+	}
+}
+
+// Go to next reactivations steps.
+func checkReactivations(ctx context.Context) {
+	toRemove := []string{}
+	toCreate := []string{}
+	for id, r := range reactivations {
+		if r.Step == REACTIVATION_STEP_REMOVE {
+			toRemove = append(toRemove, id)
+		}
+		if r.Step == REACTIVATION_STEP_WAITING && time.Now().After(r.ReactivateAt) {
+			toCreate = append(toCreate, id)
+		}
+	}
+
+	// Remove products.
+	if len(toRemove) > 0 {
+		sort.Strings(toRemove)
+		log.Printf(":: Reactivation, removing products (%d): %s", len(toRemove), strings.Join(toRemove, ", "))
+		ticketID, err := deleteZoomProducts(ctx, toRemove)
+		if !checkError(err) {
+			for _, id := range toRemove {
+				reactivations[id].ticketSent(ticketID)
+				saveReactivation(reactivations[id])
+			}
+		}
+	}
+
+	// Create products again.
+	if len(toCreate) > 0 {
+		sort.Strings(toCreate)
+		log.Printf(":: Reactivation, creating products (%d): %s", len(toCreate), strings.Join(toCreate, ", "))
+		products, skippedID, err := getZunkaProductsByID(ctx, toCreate)
+		if checkError(err) {
+			// Try again next time.
+			return
+		}
+		// Sent without filter reactivations, products are in reactivation.
+		toCreateProducts := []productZoom{}
+		for _, product := range products {
+			if _, ok := reactivations[product.ID]; ok && product.PublishState.upsert() {
+				toCreateProducts = append(toCreateProducts, product)
+			}
+		}
+		result := postZoomProducts(ctx, toCreateProducts)
+		if !result.Ok {
+			// Try again next time.
+			return
+		}
+		// Reactivations kept, created or not decoded to try again next time.
+		keep := map[string]bool{}
+		for _, id := range skippedID {
+			keep[id] = true
+		}
+		for i := range toCreateProducts {
+			r := reactivations[toCreateProducts[i].ID]
+			r.Fields = publishedFields(&toCreateProducts[i])
+			r.ticketSent(result.TicketID)
+			saveReactivation(r)
+			keep[r.ProductID] = true
+		}
+		for _, id := range toCreate {
+			// Nothing to create, like product not marked to Zoom anymore.
+			if !keep[id] {
+				deleteReactivation(id)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReactivationTicketSent(t *testing.T) {
+	tests := []struct {
+		step       string
+		wantStep   string
+		wantTicket string
+	}{
+		{REACTIVATION_STEP_REMOVE, REACTIVATION_STEP_REMOVING, "t1"},
+		{REACTIVATION_STEP_WAITING, REACTIVATION_STEP_CREATING, "t1"},
+		// Ticket already sent.
+		{REACTIVATION_STEP_REMOVING, REACTIVATION_STEP_REMOVING, "t0"},
+		{REACTIVATION_STEP_CREATING, REACTIVATION_STEP_CREATING, "t0"},
+	}
+	for _, tt := range tests {
+		r := reactivation{Step: tt.step, TicketID: "t0"}
+		r.ticketSent("t1")
+		if r.Step != tt.wantStep || r.TicketID != tt.wantTicket {
+			t.Errorf("%s: ticketSent() step = %s, ticket = %s, want %s, %s", tt.step, r.Step, r.TicketID, tt.wantStep, tt.wantTicket)
+		}
+	}
+}
+
+func TestReactivationTicketFinished(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config = defaultConfig()
+	config.Reactivation.DelayMin = 10
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		step       string
+		ok         bool
+		wantStep   string
+		wantTicket string
+		wantDone   bool
+		wantDelay  bool
+	}{
+		{"removed", REACTIVATION_STEP_REMOVING, true, REACTIVATION_STEP_WAITING, "", false, true},
+		{"remove failed", REACTIVATION_STEP_REMOVING, false, REACTIVATION_STEP_REMOVE, "", false, false},
+		{"created", REACTIVATION_STEP_CREATING, true, REACTIVATION_STEP_CREATING, "t1", true, false},
+		{"create failed", REACTIVATION_STEP_CREATING, false, REACTIVATION_STEP_WAITING, "", false, false},
+		{"not waiting ticket", REACTIVATION_STEP_WAITING, true, REACTIVATION_STEP_WAITING, "t1", false, false},
+		{"remove not sent", REACTIVATION_STEP_REMOVE, false, REACTIVATION_STEP_REMOVE, "t1", false, false},
+	}
+	for _, tt := range tests {
+		r := reactivation{Step: tt.step, TicketID: "t1"}
+		done := r.ticketFinished(tt.ok, now)
+		if done != tt.wantDone || r.Step != tt.wantStep || r.TicketID != tt.wantTicket {
+			t.Errorf("%s: ticketFinished() = %v, step = %s, ticket = %s, want %v, %s, %s", tt.name, done, r.Step, r.TicketID, tt.wantDone, tt.wantStep, tt.wantTicket)
+		}
+		if wantAt := now.Add(10 * time.Minute); tt.wantDelay && !r.ReactivateAt.Equal(wantAt) {
+			t.Errorf("%s: ReactivateAt = %v, want %v", tt.name, r.ReactivateAt, wantAt)
+		}
+	}
+}
+
+func TestReactivationSteps(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config = defaultConfig()
+	config.Reactivation.DelayMin = 10
+	now := time.Now()
+
+	// Remove and create fail once each.
+	r := reactivation{Step: REACTIVATION_STEP_REMOVE}
+	steps := []struct {
+		sent     string // Ticket sent, or ticket finished.
+		ok       bool
+		wantStep string
+	}{
+		{"t1", false, REACTIVATION_STEP_REMOVING},
+		{"", false, REACTIVATION_STEP_REMOVE},
+		{"t2", false, REACTIVATION_STEP_REMOVING},
+		{"", true, REACTIVATION_STEP_WAITING},
+		{"t3", false, REACTIVATION_STEP_CREATING},
+		{"", false, REACTIVATION_STEP_WAITING},
+		{"t4", false, REACTIVATION_STEP_CREATING},
+	}
+	for i, step := range steps {
+		if step.sent != "" {
+			r.ticketSent(step.sent)
+		} else if r.ticketFinished(step.ok, now) {
+			t.Fatalf("step %d: done before create ticket finished", i)
+		}
+		if r.Step != step.wantStep {
+			t.Fatalf("step %d: step = %s, want %s", i, r.Step, step.wantStep)
+		}
+	}
+	if !r.ticketFinished(true, now) {
+		t.Errorf("create ticket finished, want done")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	interval := 5 * time.Minute
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, interval},
+		{1, RETRY_MIN_S * time.Second},
+		{2, 2 * RETRY_MIN_S * time.Second},
+		{3, 4 * RETRY_MIN_S * time.Second},
+		{20, RETRY_MAX_MIN * time.Minute},
+		{1000, RETRY_MAX_MIN * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(interval, tt.failures); got != tt.want {
+			t.Errorf("retryDelay(%v, %d) = %v, want %v", interval, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestNextFailures(t *testing.T) {
+	if got := nextFailures(3, true); got != 0 {
+		t.Errorf("nextFailures(3, true) = %d, want 0", got)
+	}
+	if got := nextFailures(3, false); got != 4 {
+		t.Errorf("nextFailures(3, false) = %d, want 4", got)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Random delay added to jobs interval, so jobs not run always together.
+const JOB_JITTER_S = 10
+
+// Job names.
+const (
+	JOB_CHECK_CONSISTENCY = "check-consistency"
+	JOB_CHECK_PRODUCTS    = "check-products"
+	JOB_CHECK_TICKETS     = "check-tickets"
+	JOB_CHECK_ORDERS      = "check-orders"
+	JOB_PUSH_ORDERS       = "push-orders-status"
+	JOB_CHECK_PRICES      = "check-prices"
+)
+
+// Job errors.
+var (
+	errJobNotFound = errors.New("Job not found")
+	errJobRunning  = errors.New("Job already running")
+)
+
+// Scheduled job.
+type job struct {
+	Name         string        `json:"name"`
+	Interval     time.Duration `json:"interval"`
+	Jitter       time.Duration `json:"jitter"`
+	Running      bool          `json:"running"`
+	Paused       bool          `json:"paused"`
+	Failures     int           `json:"failures"` // Consecutive failures.
+	LastRunAt    time.Time     `json:"lastRunAt"`
+	LastDuration time.Duration `json:"lastDuration"`
+	LastError    string        `json:"lastError"`
+	NextRunAt    time.Time     `json:"nextRunAt"`
+	run          func(context.Context) error
+	timer        *time.Timer
+}
+
+// Job as json, durations as text like 5m0s.
+func (j job) MarshalJSON() ([]byte, error) {
+	type jobJSON job
+	return json.Marshal(struct {
+		jobJSON
+		Interval     string `json:"interval"`
+		Jitter       string `json:"jitter"`
+		LastDuration string `json:"lastDuration"`
+	}{jobJSON(j), j.Interval.String(), j.Jitter.String(), j.LastDuration.String()})
+}
+
+// Run registered jobs at intervals, one run at a time for each job.
+type jobScheduler struct {
+	ctx     context.Context
+	jobs    map[string]*job
+	mux     sync.Mutex
+	running sync.WaitGroup
+	stopped bool
+}
+
+// Job scheduler, replaced when leadership change.
+var scheduler *jobScheduler
+var muxScheduler sync.Mutex
+
+// Current job scheduler.
+func currentScheduler() *jobScheduler {
+	muxScheduler.Lock()
+	defer muxScheduler.Unlock()
+	return scheduler
+}
+
+// Set job scheduler.
+func setScheduler(s *jobScheduler) {
+	muxScheduler.Lock()
+	defer muxScheduler.Unlock()
+	scheduler = s
+}
+
+// New job scheduler, jobs are not run after context is canceled.
+func newJobScheduler(ctx context.Context) *jobScheduler {
+	return &jobScheduler{
+		ctx:  ctx,
+		jobs: map[string]*job{},
+	}
+}
+
+// Add job, first run after delay.
+func (s *jobScheduler) add(name string, interval time.Duration, jitter time.Duration, delay time.Duration, run func(context.Context) error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	j := &job{
+		Name:     name,
+		Interval: interval,
+		Jitter:   jitter,
+		run:      run,
+	}
+	s.jobs[name] = j
+	s.schedule(j, delay)
+}
+
+// Schedule next job run, must be called with lock.
+func (s *jobScheduler) schedule(j *job, delay time.Duration) {
+	if s.stopped {
+		return
+	}
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	if j.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(j.Jitter)))
+	}
+	j.NextRunAt = time.Now().Add(delay)
+	j.timer = time.AfterFunc(delay, func() {
+		s.runJob(j)
+	})
+}
+
+// Run job and schedule next run.
+func (s *jobScheduler) runJob(j *job) {
+	s.mux.Lock()
+	if s.stopped || s.ctx.Err() != nil || j.Running {
+		s.mux.Unlock()
+		return
+	}
+	if j.Paused {
+		j.NextRunAt = time.Time{}
+		s.mux.Unlock()
+		return
+	}
+	j.Running = true
+	j.LastRunAt = time.Now()
+	s.running.Add(1)
+	s.mux.Unlock()
+
+	err := s.safeRun(j)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.running.Done()
+	j.Running = false
+	j.LastDuration = time.Since(j.LastRunAt)
+	j.LastError = ""
+	if err != nil {
+		j.LastError = err.Error()
+		log.Printf("[error] Job %s failed. %v", j.Name, err)
+	}
+	j.Failures = nextFailures(j.Failures, err == nil)
+	if !j.Paused {
+		s.schedule(j, retryDelay(j.Interval, j.Failures))
+	}
+}
+
+// Run job, recovering from panic.
+func (s *jobScheduler) safeRun(j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[error] Job %s panic. %v\n%s", j.Name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run(s.ctx)
+}
+
+// Run job now.
+func (s *jobScheduler) trigger(name string) error {
+	s.mux.Lock()
+	j, ok := s.jobs[name]
+	if !ok {
+		s.mux.Unlock()
+		return errJobNotFound
+	}
+	if j.Running {
+		s.mux.Unlock()
+		return errJobRunning
+	}
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	paused := j.Paused
+	// Manual run of paused job.
+	j.Paused = false
+	s.mux.Unlock()
+
+	go func() {
+		s.runJob(j)
+		if paused {
+			s.pause(name)
+		}
+	}()
+	return nil
+}
+
+// Pause job, running job finish its run.
+func (s *jobScheduler) pause(name string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return errJobNotFound
+	}
+	j.Paused = true
+	j.NextRunAt = time.Time{}
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	return nil
+}
+
+// Resume paused job.
+func (s *jobScheduler) resume(name string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return errJobNotFound
+	}
+	if !j.Paused {
+		return nil
+	}
+	j.Paused = false
+	if !j.Running {
+		s.schedule(j, 0)
+	}
+	return nil
+}
+
+// Jobs status, ordered by name.
+func (s *jobScheduler) status() []job {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	jobs := []job{}
+	for _, j := range s.jobs {
+		jobs = append(jobs, *j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Name < jobs[k].Name })
+	return jobs
+}
+
+// Stop scheduling jobs and wait running jobs until timeout.
+func (s *jobScheduler) stop(timeout time.Duration) bool {
+	s.mux.Lock()
+	s.stopped = true
+	for _, j := range s.jobs {
+		if j.timer != nil {
+			j.timer.Stop()
+		}
+	}
+	s.mux.Unlock()
+
+	finished := make(chan bool)
+	go func() {
+		s.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Job status by name.
+func jobStatus(s *jobScheduler, name string) job {
+	for _, j := range s.status() {
+		if j.Name == name {
+			return j
+		}
+	}
+	return job{}
+}
+
+// Wait job runs finished.
+func waitJobRuns(t *testing.T, s *jobScheduler, name string, runs chan bool, count int) job {
+	for i := 0; i < count; i++ {
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("job %s not run", name)
+		}
+	}
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		if j := jobStatus(s, name); !j.Running {
+			return j
+		}
+	}
+	t.Fatalf("job %s still running", name)
+	return job{}
+}
+
+func TestJobSchedulerTrigger(t *testing.T) {
+	s := newJobScheduler(context.Background())
+	defer s.stop(time.Second)
+	runs := make(chan bool, 10)
+	release := make(chan bool)
+	s.add("job", time.Hour, 0, time.Hour, func(ctx context.Context) error {
+		runs <- true
+		<-release
+		return nil
+	})
+	if err := s.trigger("other"); err != errJobNotFound {
+		t.Errorf("trigger() unknown job error = %v, want %v", err, errJobNotFound)
+	}
+	if err := s.trigger("job"); err != nil {
+		t.Fatal(err)
+	}
+	<-runs
+	if err := s.trigger("job"); err != errJobRunning {
+		t.Errorf("trigger() running job error = %v, want %v", err, errJobRunning)
+	}
+	release <- true
+	j := waitJobRuns(t, s, "job", runs, 0)
+	if j.LastRunAt.IsZero() || j.Failures != 0 || j.LastError != "" {
+		t.Errorf("job = %+v", j)
+	}
+	// Next run after interval.
+	if wait := time.Until(j.NextRunAt); wait < 59*time.Minute {
+		t.Errorf("next run in %v, want interval", wait)
+	}
+}
+
+func TestJobSchedulerPauseResume(t *testing.T) {
+	s := newJobScheduler(context.Background())
+	defer s.stop(time.Second)
+	runs := make(chan bool, 10)
+	s.add("job", time.Hour, 0, time.Hour, func(ctx context.Context) error {
+		runs <- true
+		return nil
+	})
+	if err := s.pause("job"); err != nil {
+		t.Fatal(err)
+	}
+	if j := jobStatus(s, "job"); !j.Paused || !j.NextRunAt.IsZero() {
+		t.Errorf("paused job = %+v", j)
+	}
+	// Manual run keep job paused.
+	if err := s.trigger("job"); err != nil {
+		t.Fatal(err)
+	}
+	waitJobRuns(t, s, "job", runs, 1)
+	for start := time.Now(); !jobStatus(s, "job").Paused; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("job not paused after manual run")
+		}
+	}
+	// Resumed job run now.
+	if err := s.resume("job"); err != nil {
+		t.Fatal(err)
+	}
+	j := waitJobRuns(t, s, "job", runs, 1)
+	if j.Paused || j.NextRunAt.IsZero() {
+		t.Errorf("resumed job = %+v", j)
+	}
+	if err := s.pause("other"); err != errJobNotFound {
+		t.Errorf("pause() unknown job error = %v, want %v", err, errJobNotFound)
+	}
+	if err := s.resume("other"); err != errJobNotFound {
+		t.Errorf("resume() unknown job error = %v, want %v", err, errJobNotFound)
+	}
+}
+
+func TestJobSchedulerFailures(t *testing.T) {
+	s := newJobScheduler(context.Background())
+	defer s.stop(time.Second)
+	runs := make(chan bool, 10)
+	results := []func() error{
+		func() error { return errors.New("failed") },
+		func() error { panic("job panic") },
+		func() error { return nil },
+	}
+	run := 0
+	s.add("job", time.Hour, 0, time.Hour, func(ctx context.Context) error {
+		defer func() { runs <- true }()
+		run++
+		return results[run-1]()
+	})
+
+	tests := []struct {
+		wantFailures int
+		wantError    string
+	}{
+		{1, "failed"},
+		{2, "panic: job panic"},
+		{0, ""},
+	}
+	for i, tt := range tests {
+		if err := s.trigger("job"); err != nil {
+			t.Fatal(err)
+		}
+		j := waitJobRuns(t, s, "job", runs, 1)
+		if j.Failures != tt.wantFailures || !strings.HasPrefix(j.LastError, tt.wantError) || (tt.wantError == "") != (j.LastError == "") {
+			t.Errorf("run %d: failures = %d, error = %q, want %d, %q", i, j.Failures, j.LastError, tt.wantFailures, tt.wantError)
+		}
+		// Failed job retry with backoff.
+		want := retryDelay(time.Hour, tt.wantFailures)
+		if wait := time.Until(j.NextRunAt); wait > want || wait < want-time.Minute {
+			t.Errorf("run %d: next run in %v, want %v", i, wait, want)
+		}
+	}
+}
+
+func TestJobSchedulerStop(t *testing.T) {
+	s := newJobScheduler(context.Background())
+	runs := make(chan bool, 10)
+	release := make(chan bool)
+	s.add("job", time.Hour, 0, 0, func(ctx context.Context) error {
+		runs <- true
+		<-release
+		return nil
+	})
+	<-runs
+	if s.stop(50 * time.Millisecond) {
+		t.Errorf("stop() = true with job running")
+	}
+	close(release)
+	if !s.stop(5 * time.Second) {
+		t.Errorf("stop() = false after job finished")
+	}
+	// Not run after stopped.
+	if err := s.trigger("job"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-runs:
+		t.Errorf("job run after stop")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestJobJSON(t *testing.T) {
+	j := job{Name: "job", Interval: 5 * time.Minute, Jitter: 10 * time.Second, LastDuration: 1500 * time.Millisecond}
+	b, err := json.Marshal(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{}
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["name"] != "job" || got["interval"] != "5m0s" || got["jitter"] != "10s" || got["lastDuration"] != "1.5s" {
+		t.Errorf("json = %s", b)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+// Free shipping for Zunka product.
+func freeShipping(prodZunka *productZunka) bool {
+	// Product override.
+	if prodZunka.ZoomFreeShipping != nil {
+		return *prodZunka.ZoomFreeShipping
+	}
+	for _, rule := range config.Shipping.FreeShippingRules {
+		if rule.match(prodZunka) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if all rule conditions match.
+func (rule *freeShippingRule) match(prodZunka *productZunka) bool {
+	if rule.MinPrice > 0 && prodZunka.Price < rule.MinPrice {
+		return false
+	}
+	if rule.MaxWeight > 0 && prodZunka.Weight > rule.MaxWeight {
+		return false
+	}
+	if len(rule.Categories) > 0 {
+		for _, category := range rule.Categories {
+			if category == prodZunka.Category {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Cross docking days for Zunka product.
+func crossDocking(prodZunka *productZunka) int {
+	// Product override.
+	if prodZunka.ZoomCrossDocking != nil {
+		return *prodZunka.ZoomCrossDocking
+	}
+	crossDocking := config.Shipping.CrossDocking
+	// Own stock.
+	if prodZunka.DealerName == "" {
+		if crossDocking.OwnStock > 0 {
+			return crossDocking.OwnStock
+		}
+		return crossDocking.Default
+	}
+	// Dealer stock.
+	if days, ok := crossDocking.Dealers[prodZunka.DealerName]; ok {
+		return days
+	}
+	return crossDocking.Default
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestFreeShipping(t *testing.T) {
+	yes, no := true, false
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config = defaultConfig()
+	config.Shipping.FreeShippingRules = []freeShippingRule{
+		{MinPrice: 500, MaxWeight: 10},
+		{Categories: []string{"Notebooks"}},
+	}
+
+	tests := []struct {
+		name      string
+		prodZunka productZunka
+		want      bool
+	}{
+		{"no rule match", productZunka{Price: 100, Weight: 1}, false},
+		{"price and weight", productZunka{Price: 500, Weight: 10}, true},
+		{"price without weight", productZunka{Price: 500, Weight: 11}, false},
+		{"category", productZunka{Price: 100, Category: "Notebooks"}, true},
+		{"other category", productZunka{Price: 100, Category: "Monitores"}, false},
+		{"override true", productZunka{Price: 100, ZoomFreeShipping: &yes}, true},
+		{"override false", productZunka{Price: 500, Weight: 1, ZoomFreeShipping: &no}, false},
+	}
+	for _, tt := range tests {
+		if got := freeShipping(&tt.prodZunka); got != tt.want {
+			t.Errorf("%s: freeShipping() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCrossDocking(t *testing.T) {
+	zero, five := 0, 5
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config = defaultConfig()
+	config.Shipping.CrossDocking = crossDockingConfig{
+		Default:  3,
+		OwnStock: 1,
+		Dealers:  map[string]int{"Aldo": 4},
+	}
+
+	tests := []struct {
+		name      string
+		prodZunka productZunka
+		want      int
+	}{
+		{"own stock", productZunka{}, 1},
+		{"dealer", productZunka{DealerName: "Aldo"}, 4},
+		{"unknown dealer", productZunka{DealerName: "Allnations"}, 3},
+		{"override", productZunka{DealerName: "Aldo", ZoomCrossDocking: &five}, 5},
+		{"override zero", productZunka{DealerName: "Aldo", ZoomCrossDocking: &zero}, 0},
+	}
+	for _, tt := range tests {
+		if got := crossDocking(&tt.prodZunka); got != tt.want {
+			t.Errorf("%s: crossDocking() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Own stock without configured days.
+	config.Shipping.CrossDocking.OwnStock = 0
+	if got := crossDocking(&productZunka{}); got != 3 {
+		t.Errorf("own stock without days: crossDocking() = %v, want 3", got)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+// Quantity published to Zoom, zero means unavailable.
+func publishedQuantity(prodZunka *productZunka) int {
+	stock := config.Stock
+
+	// Safety buffer.
+	buffer := stock.Buffer
+	if categoryBuffer, ok := stock.CategoryBuffers[prodZunka.Category]; ok {
+		buffer = categoryBuffer
+	}
+	if prodZunka.ZoomStockBuffer != nil {
+		buffer = *prodZunka.ZoomStockBuffer
+	}
+	quantity := prodZunka.Quantity - buffer
+
+	// Below threshold.
+	if quantity <= 0 || quantity < stock.MinQuantity {
+		return 0
+	}
+	// Max advertised.
+	if stock.MaxQuantity > 0 && quantity > stock.MaxQuantity {
+		return stock.MaxQuantity
+	}
+	return quantity
+}
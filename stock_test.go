@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestPublishedQuantity(t *testing.T) {
+	zero, four := 0, 4
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config = defaultConfig()
+	config.Stock = stockConfig{
+		Buffer:          1,
+		CategoryBuffers: map[string]int{"Notebooks": 2},
+		MaxQuantity:     10,
+		MinQuantity:     3,
+	}
+
+	tests := []struct {
+		name      string
+		prodZunka productZunka
+		want      int
+	}{
+		{"buffer", productZunka{Quantity: 5}, 4},
+		{"category buffer", productZunka{Quantity: 5, Category: "Notebooks"}, 3},
+		{"product buffer", productZunka{Quantity: 5, Category: "Notebooks", ZoomStockBuffer: &four}, 0},
+		{"product without buffer", productZunka{Quantity: 3, ZoomStockBuffer: &zero}, 3},
+		{"below min", productZunka{Quantity: 3}, 0},
+		{"no stock", productZunka{Quantity: 0}, 0},
+		{"negative stock", productZunka{Quantity: -2}, 0},
+		{"max", productZunka{Quantity: 50}, 10},
+	}
+	for _, tt := range tests {
+		if got := publishedQuantity(&tt.prodZunka); got != tt.want {
+			t.Errorf("%s: publishedQuantity() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
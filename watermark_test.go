@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewProductsWatermark(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	t2 := t0.Add(2 * time.Minute)
+	watermark := productsWatermark{UpdatedAt: t1, ProductsID: []string{"a"}}
+
+	tests := []struct {
+		name          string
+		products      []productZoom
+		wantUpdatedAt time.Time
+		wantIDs       []string
+	}{
+		{"no products", []productZoom{}, t1, []string{"a"}},
+		{"same time", []productZoom{{ID: "b", UpdatedAt: t1}}, t1, []string{"a", "b"}},
+		{"older", []productZoom{{ID: "b", UpdatedAt: t0}}, t1, []string{"a"}},
+		{"newer", []productZoom{{ID: "b", UpdatedAt: t2}, {ID: "c", UpdatedAt: t1}, {ID: "d", UpdatedAt: t2}}, t2, []string{"b", "d"}},
+	}
+	for _, tt := range tests {
+		got := newProductsWatermark(watermark, tt.products, nil)
+		if !got.UpdatedAt.Equal(tt.wantUpdatedAt) {
+			t.Errorf("%s: updatedAt = %v, want %v", tt.name, got.UpdatedAt, tt.wantUpdatedAt)
+		}
+		if len(got.ProductsID) != len(tt.wantIDs) {
+			t.Errorf("%s: productsID = %v, want %v", tt.name, got.ProductsID, tt.wantIDs)
+			continue
+		}
+		for i := range got.ProductsID {
+			if got.ProductsID[i] != tt.wantIDs[i] {
+				t.Errorf("%s: productsID = %v, want %v", tt.name, got.ProductsID, tt.wantIDs)
+			}
+		}
+	}
+	// Last watermark not changed.
+	if len(watermark.ProductsID) != 1 {
+		t.Errorf("last watermark changed: %v", watermark.ProductsID)
+	}
+}
+
+func TestNewProductsWatermarkSkipped(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	watermark := productsWatermark{UpdatedAt: t1, ProductsID: []string{"a"}, SkippedID: []string{"s1", "s2"}}
+
+	// s1 decoded now, s2 still not decoded and s3 not decoded.
+	products := []productZoom{{ID: "s1", UpdatedAt: t1.Add(-time.Hour)}, {ID: "b", UpdatedAt: t2}}
+	got := newProductsWatermark(watermark, products, []string{"s2", "s3"})
+	if !got.UpdatedAt.Equal(t2) || len(got.ProductsID) != 1 || got.ProductsID[0] != "b" {
+		t.Errorf("watermark = %+v, want b at %v", got, t2)
+	}
+	if len(got.SkippedID) != 2 || got.SkippedID[0] != "s2" || got.SkippedID[1] != "s3" {
+		t.Errorf("skippedID = %v, want s2, s3", got.SkippedID)
+	}
+	// Skipped products kept until decoded.
+	got = newProductsWatermark(got, []productZoom{{ID: "s2", UpdatedAt: t1}, {ID: "s3", UpdatedAt: t1}}, nil)
+	if len(got.SkippedID) != 0 || !got.UpdatedAt.Equal(t2) {
+		t.Errorf("watermark = %+v, want no skipped at %v", got, t2)
+	}
+}
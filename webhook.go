@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Zoom notification events.
+const (
+	ZOOM_EVENT_RECEIPT          = "receipt.ready"
+	ZOOM_EVENT_PRODUCT_REJECTED = "product.rejected"
+	ZOOM_EVENT_ORDER_CREATED    = "order.created"
+)
+
+// Zoom notification.
+type zoomNotification struct {
+	Event     string          `json:"event"`
+	Ticket    string          `json:"ticket"`     // Receipt ready.
+	Receipt   *zoomReceipt    `json:"receipt"`    // Receipt ready, requested from Zoom if not sent.
+	ProductID string          `json:"product_id"` // Product rejected.
+	Status    int             `json:"status"`     // Product rejected.
+	Message   string          `json:"message"`    // Product rejected.
+	Order     json.RawMessage `json:"order"`      // Order created.
+}
+
+// Zoom notification saved before processing.
+type zoomNotificationDoc struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Event       string             `bson:"event"`
+	Payload     string             `bson:"payload"`
+	ReceivedAt  time.Time          `bson:"receivedAt"`
+	ProcessedAt time.Time          `bson:"processedAt,omitempty"`
+	Error       string             `bson:"error,omitempty"`
+}
+
+// Zoom notifications persistence.
+type notificationStore interface {
+	// Save notification payload, it is kept even if could not be processed.
+	saveNotification(ctx context.Context, event string, payload []byte) (primitive.ObjectID, error)
+	notificationProcessed(id primitive.ObjectID, processErr error)
+	// Payload hash of Zunka product to publish, empty if not found.
+	productPayloadHash(ctx context.Context, productID string) (string, error)
+	// Product rejected by Zoom with payload hash.
+	productRejected(productID string, status int, message string, rejectedHash string) error
+}
+
+// Zoom notifications at Zunka db.
+type mongoNotificationStore struct{}
+
+var notificationsStore notificationStore = mongoNotificationStore{}
+
+func (mongoNotificationStore) saveNotification(ctx context.Context, event string, payload []byte) (primitive.ObjectID, error) {
+	doc := zoomNotificationDoc{
+		ID:         primitive.NewObjectID(),
+		Event:      event,
+		Payload:    string(payload),
+		ReceivedAt: time.Now(),
+	}
+	collection := client.Database("zunka").Collection("zoomNotifications")
+	_, err := collection.InsertOne(ctx, doc)
+	return doc.ID, err
+}
+
+func (mongoNotificationStore) notificationProcessed(id primitive.ObjectID, processErr error) {
+	set := bson.D{{"processedAt", time.Now()}}
+	if processErr != nil {
+		set = append(set, bson.E{"error", processErr.Error()})
+	}
+	collection := client.Database("zunka").Collection("zoomNotifications")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := collection.UpdateOne(ctx, bson.D{{"_id", id}}, bson.D{{"$set", set}})
+	checkError(err)
+}
+
+func (mongoNotificationStore) productPayloadHash(ctx context.Context, productID string) (string, error) {
+	products, _, err := getZunkaProductsByID(ctx, []string{productID})
+	if err != nil || len(products) == 0 {
+		return "", err
+	}
+	return payloadHash(products[0]), nil
+}
+
+func (mongoNotificationStore) productRejected(productID string, status int, message string, rejectedHash string) error {
+	objectID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return err
+	}
+	set := bson.M{
+		"zoomStatus.lastSyncedAt": time.Now(),
+		"zoomStatus.lastStatus":   status,
+		"zoomStatus.lastMessage":  message,
+	}
+	if rejectedHash != "" {
+		set["zoomStatus.rejectedHash"] = rejectedHash
+	}
+	writeZunkaProductsZoomStatus([]mongo.WriteModel{
+		mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": objectID}).SetUpdate(bson.M{
+			"$set":   set,
+			"$unset": bson.M{"zoomStatus.payloadHash": ""},
+		}),
+	})
+	return nil
+}
+
+// Process Zoom notification, events received again have the same result.
+func processZoomNotification(ctx context.Context, n *zoomNotification) error {
+	switch n.Event {
+	case ZOOM_EVENT_RECEIPT:
+		return zoomReceiptReady(ctx, n.Ticket, n.Receipt)
+	case ZOOM_EVENT_PRODUCT_REJECTED:
+		return zoomProductRejected(ctx, n)
+	case ZOOM_EVENT_ORDER_CREATED:
+		if ordersMode == ORDERS_MODE_NONE {
+			return errors.New("Orders disabled")
+		}
+		if len(n.Order) == 0 {
+			return errors.New("No order")
+		}
+		_, err := receiveOrders(ctx, []json.RawMessage{n.Order}, ORDER_SOURCE_WEBHOOK)
+		return err
+	}
+	return errors.New("Unknown event " + n.Event)
+}
+
+// Receipt ready, ticket is finished without waiting for check tickets.
+// At standby instance or for tickets already finished, receipt is ignored.
+func zoomReceiptReady(ctx context.Context, ticketID string, receipt *zoomReceipt) error {
+	if ticketID == "" {
+		return errors.New("No ticket")
+	}
+	muxUpdateZoomProducts.Lock()
+	defer muxUpdateZoomProducts.Unlock()
+
+	// Tickets are checked by leader.
+	if !isLeader() {
+		log.Printf("Receipt ready for ticket %s, ticket checked by leader", ticketID)
+		return nil
+	}
+	ticket, ok := zoomTickets[ticketID]
+	if !ok {
+		log.Printf("[warn] Receipt ready for ticket %s not being tracked", ticketID)
+		return nil
+	}
+	if receipt == nil {
+		r, err := getZoomReceipt(ctx, ticketID)
+		if err != nil {
+			return err
+		}
+		receipt = &r
+	}
+	// Check tickets will try again.
+	if !receipt.Finished {
+		return nil
+	}
+	log.Printf(":: Receipt ready for ticket %s", ticketID)
+	zoomTicketFinished(ticket, receipt)
+	removeZoomTicket(ticketID)
+	return nil
+}
+
+// Product rejected by Zoom, rejected payload is not sent again until product changes.
+func zoomProductRejected(ctx context.Context, n *zoomNotification) error {
+	if _, err := primitive.ObjectIDFromHex(n.ProductID); err != nil {
+		return errors.New("Invalid product id " + n.ProductID)
+	}
+	status := n.Status
+	if status == 0 {
+		status = 422
+	}
+	log.Printf("[warn] Product %s rejected by Zoom. %s", n.ProductID, n.Message)
+	hash, err := notificationsStore.productPayloadHash(ctx, n.ProductID)
+	if err != nil {
+		return err
+	}
+	return notificationsStore.productRejected(n.ProductID, status, n.Message, hash)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memNotificationStore struct {
+	notifications map[primitive.ObjectID]*zoomNotificationDoc
+	hashes        map[string]string // Payload hash by product id.
+	rejected      map[string]string // Rejected hash by product id.
+}
+
+func newMemNotificationStore() *memNotificationStore {
+	return &memNotificationStore{
+		notifications: map[primitive.ObjectID]*zoomNotificationDoc{},
+		hashes:        map[string]string{},
+		rejected:      map[string]string{},
+	}
+}
+
+func (s *memNotificationStore) saveNotification(ctx context.Context, event string, payload []byte) (primitive.ObjectID, error) {
+	doc := &zoomNotificationDoc{ID: primitive.NewObjectID(), Event: event, Payload: string(payload)}
+	s.notifications[doc.ID] = doc
+	return doc.ID, nil
+}
+
+func (s *memNotificationStore) notificationProcessed(id primitive.ObjectID, processErr error) {
+	doc := s.notifications[id]
+	doc.ProcessedAt = time.Now()
+	if processErr != nil {
+		doc.Error = processErr.Error()
+	}
+}
+
+func (s *memNotificationStore) productPayloadHash(ctx context.Context, productID string) (string, error) {
+	return s.hashes[productID], nil
+}
+
+func (s *memNotificationStore) productRejected(productID string, status int, message string, rejectedHash string) error {
+	s.rejected[productID] = rejectedHash
+	return nil
+}
+
+// Notifications server with memory store, restored at test end.
+func setNotificationsTest(t *testing.T, store *memNotificationStore) *httptest.Server {
+	oldStore, oldOrdersStore, oldOrdersMode := notificationsStore, ordersStore, ordersMode
+	notificationsStore = store
+	ordersStore = newMemOrderStore(map[string]int{"p1": 10})
+	ordersMode = ORDERS_MODE_WEBHOOK
+	router := httprouter.New()
+	router.POST("/zoom/notifications", checkZoomAuthorization(zoomNotificationsHandler))
+	ts := httptest.NewServer(router)
+	t.Cleanup(func() {
+		notificationsStore, ordersStore, ordersMode = oldStore, oldOrdersStore, oldOrdersMode
+		ts.Close()
+	})
+	return ts
+}
+
+func postZoomNotification(t *testing.T, url string, user string, pass string, body []byte) int {
+	req, err := http.NewRequest("POST", url+"/zoom/notifications", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestZoomNotificationsAuthorization(t *testing.T) {
+	store := newMemNotificationStore()
+	ts := setNotificationsTest(t, store)
+	body := []byte(`{"event": "receipt.ready", "ticket": "untracked"}`)
+
+	if status := postZoomNotification(t, ts.URL, "", "", body); status != 401 {
+		t.Errorf("without credentials status = %d, want 401", status)
+	}
+	if status := postZoomNotification(t, ts.URL, zoomUser(), zoomPass()+"x", body); status != 401 {
+		t.Errorf("wrong password status = %d, want 401", status)
+	}
+	if len(store.notifications) != 0 {
+		t.Errorf("notifications saved without authorization: %d", len(store.notifications))
+	}
+	if status := postZoomNotification(t, ts.URL, zoomUser(), zoomPass(), body); status != 200 {
+		t.Errorf("status = %d, want 200", status)
+	}
+}
+
+func TestZoomNotificationsSavedAndDispatched(t *testing.T) {
+	productID := primitive.NewObjectID().Hex()
+	order, _ := json.Marshal(fakeOrder("o1", fakeOrderItem("p1", 2)))
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  bool
+	}{
+		{"invalid json", `{"event": `, 400, true},
+		{"unknown event", `{"event": "other"}`, 500, true},
+		{"receipt without ticket", `{"event": "receipt.ready"}`, 500, true},
+		{"receipt untracked ticket", `{"event": "receipt.ready", "ticket": "untracked"}`, 200, false},
+		{"product rejected", `{"event": "product.rejected", "product_id": "` + productID + `", "message": "Invalid image"}`, 200, false},
+		{"product rejected invalid id", `{"event": "product.rejected", "product_id": "1"}`, 500, true},
+		{"order without order", `{"event": "order.created"}`, 500, true},
+		{"order created", `{"event": "order.created", "order": ` + string(order) + `}`, 200, false},
+	}
+	for _, tt := range tests {
+		store := newMemNotificationStore()
+		store.hashes[productID] = "hash1"
+		ts := setNotificationsTest(t, store)
+		status := postZoomNotification(t, ts.URL, zoomUser(), zoomPass(), []byte(tt.body))
+		if status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+		}
+		// Saved and processed, even if failed.
+		if len(store.notifications) != 1 {
+			t.Fatalf("%s: notifications saved = %d, want 1", tt.name, len(store.notifications))
+		}
+		for _, doc := range store.notifications {
+			if doc.Payload != tt.body || doc.ProcessedAt.IsZero() || (doc.Error != "") != tt.wantError {
+				t.Errorf("%s: notification = %+v, want error %v", tt.name, doc, tt.wantError)
+			}
+		}
+		if tt.name == "product rejected" && store.rejected[productID] != "hash1" {
+			t.Errorf("%s: rejected = %v, want hash1", tt.name, store.rejected)
+		}
+		if tt.name == "order created" {
+			if _, ok := ordersStore.(*memOrderStore).orders["o1"]; !ok {
+				t.Errorf("%s: order not received", tt.name)
+			}
+		}
+	}
+}
+
+func TestProductRejectedNotSentAgain(t *testing.T) {
+	p := productZoom{ID: "1", Name: "Notebook", Price: 100, Quantity: 1, PublishState: PUBLISH_STATE_PUBLISHABLE}
+	pr := productZoomR{ID: "1", Active: false}
+	if p.Diff(&pr) == "" {
+		t.Fatalf("product not active at Zoom, want diff")
+	}
+	p.RejectedHash = payloadHash(p)
+	if diff := p.Diff(&pr); diff != "" {
+		t.Errorf("rejected payload diff = %s, want no diff", diff)
+	}
+	// Product changed after rejected.
+	p.Price = 90
+	if p.Diff(&pr) == "" {
+		t.Errorf("changed after rejected, want diff")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Zoom webservice host, ZOOM_HOST to use other host, like fake zoom server.
+func zoomAPIHost() string {
+	host := os.Getenv("ZOOM_HOST")
+	if host == "" {
+		return zoomHost()
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// Request zoom webservice, body is sent as json if not nil.
+func zoomRequest(ctx context.Context, method string, path string, body interface{}) (resBody []byte, err error) {
+	var reqBody io.Reader
+	if body != nil {
+		bodyJSON, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewBuffer(bodyJSON)
+	}
+
+	client := &http.Client{}
+	req, err := http.NewRequestWithContext(ctx, method, zoomAPIHost()+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(zoomUser(), zoomPass())
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	// No success.
+	if res.StatusCode != 200 && res.StatusCode != 201 {
+		return resBody, errors.New(fmt.Sprintf("Not received status 200 neither 201. %s %s, status: %v, body: %v", method, path, res.StatusCode, string(resBody)))
+	}
+	return resBody, nil
+}
+
+// Remove products from zoom, return ticket id.
+func deleteZoomProducts(ctx context.Context, productsID []string) (ticketID string, err error) {
+	ticket, err := requestDeleteZoomProducts(ctx, productsID)
+	if err != nil {
+		return "", err
+	}
+	addZoomTicket(&ticket)
+	log.Printf("\tTicket %v added (removed products)", ticket.ID)
+	saveSyncHistoryDelete(productsID, ticket.ID)
+	return ticket.ID, nil
+}
+
+// Request products remove from zoom, ticket is not tracked.
+func requestDeleteZoomProducts(ctx context.Context, productsID []string) (ticket zoomTicket, err error) {
+	type productID struct {
+		ID string `json:"id"`
+	}
+	p := struct {
+		Products []productID `json:"products"`
+	}{
+		Products: []productID{},
+	}
+	for _, id := range productsID {
+		p.Products = append(p.Products, productID{ID: id})
+	}
+
+	resBody, err := zoomRequest(ctx, "DELETE", "/products", p)
+	if err != nil {
+		return ticket, err
+	}
+	err = json.Unmarshal(resBody, &ticket)
+	if err != nil {
+		return ticket, err
+	}
+	ticket.ProductsID = productsID
+	ticket.ReceivedAt = time.Now()
+	return ticket, nil
+}
+
+// Zoom marketplace.
+type zoomMarketplace struct{}
+
+func (z *zoomMarketplace) name() string {
+	return "zoom"
+}
+
+func (z *zoomMarketplace) flag() string {
+	return "marketZoom"
+}
+
+// Zoom product, published as in products sync.
+func (z *zoomMarketplace) convert(prodZunka *productZunka, marked bool) marketplaceProduct {
+	prodZunka.MarketZoom = marked
+	prodZoom := convertProductZunkaToZoom(prodZunka)
+	return marketplaceProduct{
+		ID:           prodZoom.ID,
+		Name:         prodZoom.Name,
+		Price:        prodZoom.Price,
+		Quantity:     prodZoom.Quantity,
+		PublishState: prodZoom.PublishState,
+		Payload:      prodZoom,
+	}
+}
+
+func (z *zoomMarketplace) listProducts(ctx context.Context) ([]marketplaceProduct, error) {
+	c := make(chan productZoomRAOk)
+	go getZoomProducts(ctx, c)
+	result := <-c
+	if !result.Ok {
+		return nil, errors.New("Could not get Zoom products")
+	}
+	products := []marketplaceProduct{}
+	for _, pr := range *result.Products {
+		products = append(products, marketplaceProduct{
+			ID:       pr.ID,
+			Name:     pr.Name,
+			Price:    pr.Price,
+			Quantity: pr.Quantity,
+			Active:   pr.Active,
+		})
+	}
+	return products, nil
+}
+
+// Upsert products, ticket is not tracked by check tickets.
+func (z *zoomMarketplace) upsertProducts(ctx context.Context, products []marketplaceProduct) (ticketID string, err error) {
+	p := struct {
+		Products []interface{} `json:"products"`
+	}{
+		Products: []interface{}{},
+	}
+	for _, product := range products {
+		p.Products = append(p.Products, product.Payload)
+	}
+	resBody, err := zoomRequest(ctx, "POST", "/products", p)
+	if err != nil {
+		return "", err
+	}
+	ticket := zoomTicket{}
+	err = json.Unmarshal(resBody, &ticket)
+	return ticket.ID, err
+}
+
+// Delete products, ticket is not tracked by check tickets.
+func (z *zoomMarketplace) deleteProducts(ctx context.Context, productsID []string) (ticketID string, err error) {
+	ticket, err := requestDeleteZoomProducts(ctx, productsID)
+	return ticket.ID, err
+}
+
+func (z *zoomMarketplace) receipt(ctx context.Context, ticketID string) (marketplaceReceipt, error) {
+	receipt, err := getZoomReceipt(ctx, ticketID)
+	if err != nil {
+		return marketplaceReceipt{}, err
+	}
+	result := marketplaceReceipt{Finished: receipt.Finished, Results: []marketplaceResult{}}
+	for _, r := range receipt.Results {
+		result.Results = append(result.Results, marketplaceResult{ProductID: r.ProductID, Status: r.Status, Message: r.Message})
+	}
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Zoom status written into Zunka product, to be shown at Zunka site.
+// zoomStatus: {
+//     lastSyncedAt, lastTicket, lastStatus, lastMessage, warnMessages, // From last ticket receipt.
+//     payloadHash, // From last payload successfully sent.
+//     rejectedHash, // From last payload rejected, not sent again.
+//     active, validationErrors, checkedAt // From last consistency check.
+// }
+
+// Update Zunka products zoom status from ticket receipt.
+func updateZunkaProductsZoomStatusReceipt(ticket *zoomTicket, receipt *zoomReceipt) {
+	models := []mongo.WriteModel{}
+	for _, result := range receipt.Results {
+		objectID, err := primitive.ObjectIDFromHex(result.ProductID)
+		if err != nil {
+			// Not a Zunka product.
+			continue
+		}
+		warnMessages := result.WarnMessages
+		if warnMessages == nil {
+			warnMessages = []string{}
+		}
+		set := bson.M{
+			"zoomStatus.lastSyncedAt": time.Now(),
+			"zoomStatus.lastTicket":   ticket.ID,
+			"zoomStatus.lastStatus":   result.Status,
+			"zoomStatus.lastMessage":  result.Message,
+			"zoomStatus.warnMessages": warnMessages,
+		}
+		update := bson.M{"$set": set}
+		hash, sent := ticket.PayloadHashes[result.ProductID]
+		if sent && (result.Status == 200 || result.Status == 201) {
+			// Product sent.
+			set["zoomStatus.payloadHash"] = hash
+			update["$unset"] = bson.M{"zoomStatus.rejectedHash": ""}
+		} else if !sent && (result.Status == 200 || result.Status == 201 || result.Status == 404) {
+			// Product removed, must be sent again if created.
+			update["$unset"] = bson.M{"zoomStatus.payloadHash": ""}
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": objectID}).
+			SetUpdate(update))
+	}
+	writeZunkaProductsZoomStatus(models)
+}
+
+// Update Zunka products zoom status from Zunka and Zoom products.
+func updateZunkaProductsZoomStatus(zunkaProducts []productZoom, zoomProducts []productZoomR) {
+	activeAtZoom := map[string]bool{}
+	activeObjectIDs := []primitive.ObjectID{}
+	for _, product := range zoomProducts {
+		if product.Active {
+			activeAtZoom[product.ID] = true
+		}
+	}
+
+	models := []mongo.WriteModel{}
+	for _, product := range zunkaProducts {
+		active := activeAtZoom[product.ID]
+		if active {
+			activeObjectIDs = append(activeObjectIDs, zunkaObjectID(product.ID))
+		}
+		// Only products marked or at Zoom.
+		if !product.MarketZoom && !active {
+			continue
+		}
+		validationErrors := product.ValidationErrors
+		if validationErrors == nil {
+			validationErrors = []string{}
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": zunkaObjectID(product.ID)}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"zoomStatus.active":           active,
+				"zoomStatus.validationErrors": validationErrors,
+				"zoomStatus.checkedAt":        time.Now(),
+			}}))
+	}
+	// Products not active at Zoom anymore.
+	models = append(models, mongo.NewUpdateManyModel().
+		SetFilter(bson.M{
+			"_id":               bson.M{"$nin": activeObjectIDs},
+			"zoomStatus.active": true,
+		}).
+		SetUpdate(bson.M{"$set": bson.M{
+			"zoomStatus.active":    false,
+			"zoomStatus.checkedAt": time.Now(),
+		}}))
+	writeZunkaProductsZoomStatus(models)
+}
+
+// Write zoom status into Zunka products.
+func writeZunkaProductsZoomStatus(models []mongo.WriteModel) {
+	if len(models) == 0 {
+		return
+	}
+	collection := client.Database("zunka").Collection("products")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.BulkWrite(ctx, models)
+	checkError(err)
+}
+
+// Object id from Zunka product id.
+func zunkaObjectID(id string) primitive.ObjectID {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	checkError(err)
+	return objectID
+}